@@ -0,0 +1,127 @@
+package main
+
+import "iter"
+
+// All-gather algorithms, for p members each with a block of b words
+//
+//	naive 	- everyone sends its block to everyone, rebuilt with At() 	p-1 messages, (p-1)b words
+//	ring 	- pass blocks around the ring 							p-1 messages, (p-1)b words
+//	bruck 	- Bruck et al., distance doubles each step 				ceil(log p) messages, (p-1)b words
+//
+// ring & bruck work on contiguous slices & copy whole runs instead of element by element
+const (
+	allGatherNaive = "naive"
+	allGatherRing  = "ring"
+	allGatherBruck = "bruck"
+	allGatherAuto  = "auto"
+)
+
+var allGatherAlgos = []string{allGatherNaive, allGatherRing, allGatherBruck, allGatherAuto}
+
+// Below this many gathered bytes take Bruck's fewer messages, above it the ring (MPICH's default)
+const allGatherShortMsg = 81920
+
+// Algorithm used by Node.allGatherAcrossNodeRows/Columns, set from the Config by applyConfig
+var allGatherAlgo = allGatherAuto
+
+// pickAllGather - resolve auto by total gathered size
+func pickAllGather(algo string, totalWords, size int) string {
+	if algo != allGatherAuto {
+		return algo
+	}
+	if totalWords*8 < allGatherShortMsg {
+		return allGatherBruck
+	}
+	return allGatherRing
+}
+
+// allGatherv - every member contributes mine (counts[rank] words), everyone gets all blocks
+// Returns the blocks concatenated in rank order & where each one starts (len = size+1)
+func (c *Communicator) allGatherv(mine []float64, counts []int, algo string) ([]float64, []int) {
+	size, rank := c.Size(), c.Rank()
+	offsets := countOffsets(counts)
+	buf := make([]float64, offsets[size])
+	copy(buf[offsets[rank]:offsets[rank+1]], mine)
+
+	if size > 1 {
+		algo = pickAllGather(algo, len(buf), size)
+		if algo == allGatherNaive {
+			// naive has no contiguous version, the Node collectives keep their own
+			parts := c.exchange(vecOf(mine))
+			for i := range parts {
+				copy(buf[offsets[i]:offsets[i+1]], vecData(parts[i]))
+			}
+			c.recycle(parts)
+		} else {
+			c.run(allGathervOps(algo, rank, counts), buf, tagAllGather)
+		}
+	}
+	return buf, offsets
+}
+
+// allGathervOps - my schedule for an all-gather of blocks of counts[i] words (see schedule.go)
+func allGathervOps(algo string, rank int, counts []int) iter.Seq[op] {
+	size := len(counts)
+	offsets := countOffsets(counts)
+	block := func(i int) span {
+		i = ((i % size) + size) % size
+		return span{offsets[i], offsets[i+1]}
+	}
+
+	switch pickAllGather(algo, offsets[size], size) {
+	case allGatherRing:
+		return ringAllGatherOps(rank, size, block)
+	case allGatherBruck:
+		return bruckAllGatherOps(rank, size, block)
+	default:
+		return exchangeOps(rank, counts)
+	}
+}
+
+// ringAllGatherOps - step s: send block rank-s right, get block rank-s-1 from the left
+func ringAllGatherOps(rank, size int, block func(int) span) iter.Seq[op] {
+	right, left := (rank+1)%size, (rank-1+size)%size
+	return func(yield func(op) bool) {
+		for s := 0; s < size-1; s++ {
+			if !yield(sendOp(right, block(rank-s))) || !yield(recvOp(left, block(rank-s-1))) {
+				return
+			}
+		}
+	}
+}
+
+// bruckAllGatherOps - at distance d I hold blocks rank .. rank+d-1, send them to
+// rank-d & get blocks rank+d .. rank+2d-1 from rank+d. Blocks are placed by their
+// real index, so there's no final rotation.
+func bruckAllGatherOps(rank, size int, block func(int) span) iter.Seq[op] {
+	return func(yield func(op) bool) {
+		for dist := 1; dist < size; dist *= 2 {
+			cnt := dist
+			if size-dist < cnt {
+				cnt = size - dist
+			}
+			out, in := make([]span, cnt), make([]span, cnt)
+			for i := 0; i < cnt; i++ {
+				out[i], in[i] = block(rank+i), block(rank+dist+i)
+			}
+			if !yield(sendOp((rank-dist+size)%size, out...)) || !yield(recvOp((rank+dist)%size, in...)) {
+				return
+			}
+		}
+	}
+}
+
+// allGatherCost - messages & words each member sends gathering blocks of b words
+func allGatherCost(algo string, blockWords, size int) (msgs, sent int) {
+	if size == 1 {
+		return 0, 0
+	}
+	if pickAllGather(algo, blockWords*size, size) == allGatherBruck {
+		steps := 0
+		for dist := 1; dist < size; dist *= 2 {
+			steps++
+		}
+		return steps, (size - 1) * blockWords
+	}
+	return size - 1, (size - 1) * blockWords
+}
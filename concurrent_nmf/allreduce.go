@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// All-reduce algorithms, for a matrix of w words on p members
+//
+//	naive 	- everyone sends everything to everyone 			p-1 messages, (p-1)w words
+//	ring 	- reduce-scatter then all-gather around a ring 		2(p-1) messages, ~2w words
+//	rd 		- recursive doubling, exchange everything log p times 	log p messages, w log p words
+//	rh 		- recursive halving reduce-scatter, then recursive
+//			  doubling all-gather (Rabenseifner) 				2 log p messages, ~2w words
+//
+// rd & rh fold the extra members into a power of 2 first (like MPICH)
+const (
+	allReduceNaive       = "naive"
+	allReduceRing        = "ring"
+	allReduceRecDoubling = "rd"
+	allReduceRecHalving  = "rh"
+	allReduceAuto        = "auto"
+)
+
+var allReduceAlgos = []string{allReduceNaive, allReduceRing, allReduceRecDoubling, allReduceRecHalving, allReduceAuto}
+
+// Every algorithm adds up the parts in an order fixed by the ranks, never by which
+// message gets there first, so a run gives the same bits every time & on every member.
+// The orders differ between algorithms though (ring starts each block's sum at another
+// rank, rd & rh add in a tree), so W & H differ in their last bits from one to the
+// next. -reproducible takes naive everywhere, which adds in rank order like localReduce.
+
+// Below this many bytes latency dominates, so take the fewest messages (MPICH's default)
+const allReduceShortMsg = 2048
+
+// Algorithm used by Node.allReduce, set from the Config by applyConfig
+var allReduceAlgo = allReduceAuto
+
+func checkAlgo(name, algo string, algos []string) error {
+	for _, a := range algos {
+		if a == algo {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown %s algorithm %q (want one of %v)", name, algo, algos)
+}
+
+// pickAllReduce - resolve auto by message size & communicator size
+func pickAllReduce(algo string, words, size int) string {
+	if algo != allReduceAuto {
+		return algo
+	}
+	switch {
+	case words*8 <= allReduceShortMsg || size <= 2:
+		return allReduceRecDoubling
+	case size&(size-1) == 0:
+		return allReduceRecHalving
+	default:
+		return allReduceRing
+	}
+}
+
+// allReduce - sum of part over all members, every member gets the result
+func (c *Communicator) allReduce(part *mat.Dense, algo string) *mat.Dense {
+	r, cols := part.Dims()
+	if c.Size() == 1 {
+		return mat.DenseCopyOf(part)
+	}
+
+	algo = pickAllReduce(algo, r*cols, c.Size())
+	if algo == allReduceNaive {
+		parts := c.exchange(part)
+		ret := localReduce(parts)
+		c.recycle(parts)
+		return &ret
+	}
+	data := denseData(part)
+	c.run(allReduceOps(algo, c.Rank(), c.Size(), r*cols), data, tagAllReduce)
+	return mat.NewDense(r, cols, data)
+}
+
+// allReduceOps - my schedule for an all-reduce of words words (see schedule.go)
+func allReduceOps(algo string, rank, size, words int) iter.Seq[op] {
+	switch pickAllReduce(algo, words, size) {
+	case allReduceRing:
+		return ringAllReduceOps(rank, size, words)
+	case allReduceRecDoubling:
+		return recDoublingAllReduceOps(rank, size, words)
+	case allReduceRecHalving:
+		return recHalvingAllReduceOps(rank, size, words)
+	default:
+		counts := make([]int, size)
+		for i := range counts {
+			counts[i] = words
+		}
+		return exchangeOps(rank, counts)
+	}
+}
+
+// Utility Functions
+
+// denseData - copy of the elements of x, row-major
+func denseData(x *mat.Dense) []float64 {
+	return mat.DenseCopyOf(x).RawMatrix().Data
+}
+
+// denseView - elements of x, row-major, not copied unless x is a slice of a bigger matrix
+// Only for reading.
+func denseView(x *mat.Dense) []float64 {
+	raw := x.RawMatrix()
+	if raw.Stride != raw.Cols {
+		return denseData(x)
+	}
+	return raw.Data[:raw.Rows*raw.Cols]
+}
+
+// vecOf - data as a 1 x len message (copied, so the sender can keep working on data)
+func vecOf(data []float64) *mat.Dense {
+	return vec(append([]float64(nil), data...))
+}
+
+// vec - data as a 1 x len matrix, not copied
+func vec(data []float64) *mat.Dense {
+	if len(data) == 0 {
+		return &mat.Dense{}
+	}
+	return mat.NewDense(1, len(data), data)
+}
+
+func vecData(x mat.Dense) []float64 {
+	if x.IsEmpty() {
+		return nil
+	}
+	return x.RawMatrix().Data
+}
+
+func addInto(dst, src []float64) {
+	for i := range dst {
+		dst[i] += src[i]
+	}
+}
+
+// ringAllReduceOps - data split into p chunks
+// p-1 steps of reduce-scatter: pass a chunk right, add the one from the left
+// p-1 steps of all-gather: pass the finished chunks around the ring
+func ringAllReduceOps(rank, size, words int) iter.Seq[op] {
+	right, left := (rank+1)%size, (rank-1+size)%size
+
+	return func(yield func(op) bool) {
+		chunk := func(i int) span {
+			i = ((i % size) + size) % size
+			return span{blockOffset(words, size, i), blockOffset(words, size, i+1)}
+		}
+		for s := 0; s < size-1; s++ {
+			if !yield(sendOp(right, chunk(rank-s))) || !yield(recvAddOp(left, chunk(rank-s-1))) {
+				return
+			}
+		}
+		// now chunk rank+1 is fully reduced here
+		for s := 0; s < size-1; s++ {
+			if !yield(sendOp(right, chunk(rank+1-s))) || !yield(recvOp(left, chunk(rank-s))) {
+				return
+			}
+		}
+	}
+}
+
+// recDoublingAllReduceOps - log p rounds, exchange everything with partner rank ^ mask
+func recDoublingAllReduceOps(rank, size, words int) iter.Seq[op] {
+	all := span{0, words}
+	newRank, pof2, rem := fold(rank, size)
+
+	return func(yield func(op) bool) {
+		if o, ok := foldOp(rank, newRank, rem, all); ok && !yield(o) {
+			return
+		}
+		if newRank >= 0 {
+			for mask := 1; mask < pof2; mask <<= 1 {
+				partner := foldedRank(newRank^mask, rem)
+				if !yield(sendOp(partner, all)) || !yield(recvAddOp(partner, all)) {
+					return
+				}
+			}
+		}
+		if o, ok := unfoldOp(rank, newRank, rem, func(int) span { return all }); ok {
+			yield(o)
+		}
+	}
+}
+
+// recHalvingAllReduceOps - Rabenseifner's algorithm
+// reduce-scatter: log p rounds, send the half of my window I'm not keeping to
+// partner rank ^ mask, add the half I keep. Ends with chunk newRank reduced.
+// all-gather: log p rounds of recursive doubling, windows double each round.
+func recHalvingAllReduceOps(rank, size, words int) iter.Seq[op] {
+	all := span{0, words}
+	newRank, pof2, rem := fold(rank, size)
+
+	return func(yield func(op) bool) {
+		window := func(lo, hi int) span {
+			return span{blockOffset(words, pof2, lo), blockOffset(words, pof2, hi)}
+		}
+		if o, ok := foldOp(rank, newRank, rem, all); ok && !yield(o) {
+			return
+		}
+		if newRank >= 0 {
+			lo, hi := 0, pof2
+			for mask := pof2 / 2; mask > 0; mask >>= 1 {
+				partner := foldedRank(newRank^mask, rem)
+				mid := (lo + hi) / 2
+				send, keep := window(mid, hi), window(lo, mid)
+				if newRank&mask == 0 {
+					hi = mid
+				} else {
+					send, keep = keep, send
+					lo = mid
+				}
+				if !yield(sendOp(partner, send)) || !yield(recvAddOp(partner, keep)) {
+					return
+				}
+			}
+
+			for mask := 1; mask < pof2; mask <<= 1 {
+				partner := foldedRank(newRank^mask, rem)
+				theirLo := (newRank ^ mask) &^ (mask - 1)
+				if !yield(sendOp(partner, window(lo, hi))) || !yield(recvOp(partner, window(theirLo, theirLo+mask))) {
+					return
+				}
+				if theirLo < lo {
+					lo = theirLo
+				} else {
+					hi = theirLo + mask
+				}
+			}
+		}
+		if o, ok := unfoldOp(rank, newRank, rem, func(int) span { return all }); ok {
+			yield(o)
+		}
+	}
+}
+
+// allReduceCost - messages & words the busiest member sends in one all-reduce of w words
+func allReduceCost(algo string, words, size int) (msgs, sent int) {
+	if size == 1 {
+		return 0, 0
+	}
+	pof2, logP := powerOf2Below(size)
+	fold := 0
+	if size > pof2 {
+		fold = 1 // the odd member of a folded pair also sends the result back
+	}
+
+	switch pickAllReduce(algo, words, size) {
+	case allReduceNaive:
+		return size - 1, (size - 1) * words
+	case allReduceRing:
+		return 2 * (size - 1), 2 * (size - 1) * blockSizes(words, size)[0]
+	case allReduceRecDoubling:
+		return logP + fold, (logP + fold) * words
+	default: // allReduceRecHalving
+		sent := 0
+		for span := pof2 / 2; span > 0; span /= 2 {
+			sent += 2 * span * blockSizes(words, pof2)[0]
+		}
+		return 2*logP + fold, sent + fold*words
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"569-final-project/nmfcore"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Distributed beta-divergence NMF (-objective kl, or beta with -betadiv), multiplicative updates:
+//
+//	W = W * [((A * (W H)^(b-2)) Ht) / ((W H)^(b-1) Ht)]^g
+//	H = H * [(Wt (A * (W H)^(b-2))) / (Wt (W H)^(b-1))]^g
+//
+// b = 2 is the Frobenius norm (but parallelNMF's Gram matrices do that far cheaper),
+// b = 1 KL, b = 0 Itakura-Saito. g is the exponent, see nmfcore.BetaExponent.
+// nmfcore/beta.go has the same updates on the whole matrices, & the divergence.
+//
+// The powers of W H are element-wise, so node (i,j) works them out on its own aPiece,
+// from W H's block Wi Hj - both factors get all-gathered before the element-wise
+// step, where the Frobenius updates only need one. For KL the denominators are
+// ones matrices times a factor, which only sum: every row of 1 Ht is the row sums of
+// H, every column of Wt 1 the column sums of W. Each node adds up its Hji (Wij) & an
+// all-reduce of k words does the rest. Any other b needs the denominators' products
+// & a second reduce-scatter.
+//
+// One iteration, with the matching lines of MPI-FAUN:
+//
+//	a) Rij = Aij * (Wi Hj)^(b-2), Sij = (Wi Hj)^(b-1) 	(6) 	Wi Hj is left from k) of the last iteration
+//	b) Vij = Rij Hj^T, Sij Hj^T 						(6)
+//	c) reduce-scatter them across the row 				(7) 	numerator & denominator for Wij
+//	d) KL: row sums of Hji, all-reduce 				(3, 4) 	denominator for Wij
+//	e) Wij = Wij * (numerator / denominator)^g 			(8)
+//	f) all-gather Wij across the row 					(11) 	Wi
+//	g) Yij = Wi^T Rij, Wi^T Sij (Wi Hj new) 			(12)
+//	h) reduce-scatter them across the column 			(13) 	numerator & denominator for Hji
+//	i) KL: column sums of Wij, all-reduce 			(9, 10) denominator for Hji
+//	j) Hji = Hji * (numerator / denominator)^g 			(14)
+//	k) all-gather Hji across the column, Wi Hj 			(5, 6) 	for the objective & the next a)
+//
+// So per iteration KL has the same collectives as parallelNMF, with k-word all-reduces
+// in place of the k x k ones, but 4 local products with A's shape instead of 2.
+// Before the first iteration both factors are all-gathered once (the prologue).
+const (
+	objectiveFrobenius = "frobenius"
+	objectiveKL        = "kl"
+	objectiveBeta      = "beta"
+)
+
+var objectives = []string{objectiveFrobenius, objectiveKL, objectiveBeta}
+
+// Set from the Config by applyConfig
+var (
+	objective = objectiveFrobenius // objective minimized
+	betaDiv   float64              // b, for all but frobenius
+	betaGamma float64              // g
+)
+
+const betaErrorWords = 2 // divergence & the vote on the time budget
+
+// nmfProgram - the goroutine/process body for the objective picked for the run
+func nmfProgram() func(node *Node, maxIter int) {
+	if objective == objectiveFrobenius {
+		return parallelNMF
+	}
+	return parallelBetaNMF
+}
+
+func parallelBetaNMF(node *Node, maxIter int) {
+	node.splitGrid()
+
+	Wij, Hji, done := node.initFactors()
+	smallBlockSizeW, smallBlockSizeH := wRows[node.nodeID], hCols[node.nodeID]
+	aRows, aCols := node.aPiece.Dims()
+	sums := betaDiv == 1 // KL, see d) & i)
+	if reporting {
+		node.report(&Wij, &Hji, done)
+	}
+
+	// prologue
+	Wi := node.allGatherAcrossNodeRows(&Wij)
+	Hj := node.allGatherAcrossNodeColumns(&Hji)
+	WH := &mat.Dense{}
+	node.compute(phaseMM, mulFlops(aRows, k, aCols), func() { WH.Mul(Wi, Hj) })
+
+	// In share mode the naive reduce-scatters send V & Y as they are, but no other
+	// node reads them once the collective returns (see recycle).
+	Rij, Sij := &mat.Dense{}, &mat.Dense{}
+	numerVij, denomVij, numerYij, denomYij := &mat.Dense{}, &mat.Dense{}, &mat.Dense{}, &mat.Dense{}
+
+	var cv *convergence
+	if trackError {
+		cv = node.newConvergence()
+	}
+	iters := maxIter
+	for iter := 0; iter < maxIter; iter++ {
+		node.setEpoch(iter)
+		// Update W Part
+		// a) & b)
+		node.compute(phaseMM, betaProductFlops(aRows, aCols, sums), func() {
+			betaRatios(node.aPiece, WH, Rij, Sij, sums)
+			numerVij.Mul(Rij, Hj.T()) // (m/pr) x k
+			if !sums {
+				denomVij.Mul(Sij, Hj.T())
+			}
+		})
+		// c) & d)
+		numerW := node.reduceScatterAcrossNodeRows(numerVij) // (m/p) x k
+		var denomW mat.Matrix
+		if sums {
+			denomW = broadcastRows(node.allReduce(node.sums(&Hji, false)), smallBlockSizeW)
+		} else {
+			denomW = node.reduceScatterAcrossNodeRows(denomVij)
+		}
+		// e)
+		node.compute(phaseNLS, betaUpdateFlops(smallBlockSizeW), func() { betaUpdate(&Wij, numerW, denomW) })
+
+		// Update H Part
+		// f)
+		Wi = node.allGatherAcrossNodeRows(&Wij) // (m/p_r) x k
+		// g)
+		node.compute(phaseMM, mulFlops(aRows, k, aCols)+betaProductFlops(aRows, aCols, sums), func() {
+			WH.Mul(Wi, Hj)
+			betaRatios(node.aPiece, WH, Rij, Sij, sums)
+			numerYij.Mul(Wi.T(), Rij) // k x (n/p_c)
+			if !sums {
+				denomYij.Mul(Wi.T(), Sij)
+			}
+		})
+		// h) & i)
+		numerH := node.reduceScatterAcrossNodeColumns(numerYij) // k x (n/p)
+		var denomH mat.Matrix
+		if sums {
+			denomH = broadcastRows(node.allReduce(node.sums(&Wij, true)), smallBlockSizeH).T()
+		} else {
+			denomH = node.reduceScatterAcrossNodeColumns(denomYij)
+		}
+		// j)
+		node.compute(phaseNLS, betaUpdateFlops(smallBlockSizeH), func() { betaUpdate(&Hji, numerH, denomH) })
+		// k)
+		Hj = node.allGatherAcrossNodeColumns(&Hji) // k x (n/p_c)
+		node.compute(phaseMM, mulFlops(aRows, k, aCols), func() { WH.Mul(Wi, Hj) })
+		if reporting {
+			node.report(&Wij, &Hji, done+iter+1)
+		}
+
+		// Objective & stopping criteria (see convergence.go)
+		if cv == nil {
+			continue
+		}
+		if reason := node.checkBetaConvergence(cv, iter, WH); reason != "" {
+			if node.nodeID == 0 {
+				fmt.Printf("Stopped after %d iterations: %s\n", iter+1, reason)
+			}
+			iters = iter + 1
+			break
+		}
+	}
+	node.world.clock.Iters = iters
+	node.finish(&Wij, &Hji, done+iters)
+
+	wg.Done()
+}
+
+// desBetaProgram - desProgram for parallelBetaNMF, same steps in the same order
+func desBetaProgram(id int) (prologue, program []desStep) {
+	row, col := nodeRow(id), nodeCol(id)
+	aRows, aCols := aPieceRows(id), aPieceCols(id)
+	world := func(r int) int { return r }
+	rowComm := func(r int) int { return row*numNodeCols + r }
+	colComm := func(r int) int { return r*numNodeCols + col }
+	sums := betaDiv == 1
+
+	prologue = []desStep{
+		{phase: phaseAllGather, ops: allGathervOps(allGatherAlgo, col, wCounts(row)), peer: rowComm},
+		{phase: phaseAllGather, ops: allGathervOps(allGatherAlgo, row, hCounts(col)), peer: colComm},
+		{phase: phaseMM, flops: mulFlops(aRows, k, aCols)},
+	}
+	reduceScatterW := desStep{phase: phaseReduceScatter, ops: reduceScattervOps(reduceScatterAlgo, col, wCounts(row)), peer: rowComm}
+	reduceScatterH := desStep{phase: phaseReduceScatter, ops: reduceScattervOps(reduceScatterAlgo, row, hCounts(col)), peer: colComm}
+
+	// Update W Part
+	// a) & b)
+	program = append(program, desStep{phase: phaseMM, flops: betaProductFlops(aRows, aCols, sums)})
+	// c) & d)
+	program = append(program, reduceScatterW)
+	if sums {
+		program = append(program,
+			desStep{phase: phaseGram, flops: elemFlops(k, hCols[id])},
+			desStep{phase: phaseAllReduce, ops: allReduceOps(allReduceAlgo, id, numNodes, k), peer: world},
+		)
+	} else {
+		program = append(program, reduceScatterW)
+	}
+	program = append(program,
+		// e)
+		desStep{phase: phaseNLS, flops: betaUpdateFlops(wRows[id])},
+		// Update H Part
+		// f)
+		desStep{phase: phaseAllGather, ops: allGathervOps(allGatherAlgo, col, wCounts(row)), peer: rowComm},
+		// g)
+		desStep{phase: phaseMM, flops: mulFlops(aRows, k, aCols) + betaProductFlops(aRows, aCols, sums)},
+		// h) & i)
+		reduceScatterH,
+	)
+	if sums {
+		program = append(program,
+			desStep{phase: phaseGram, flops: elemFlops(wRows[id], k)},
+			desStep{phase: phaseAllReduce, ops: allReduceOps(allReduceAlgo, id, numNodes, k), peer: world},
+		)
+	} else {
+		program = append(program, reduceScatterH)
+	}
+	program = append(program,
+		// j)
+		desStep{phase: phaseNLS, flops: betaUpdateFlops(hCols[id])},
+		// k)
+		desStep{phase: phaseAllGather, ops: allGathervOps(allGatherAlgo, row, hCounts(col)), peer: colComm},
+		desStep{phase: phaseMM, flops: mulFlops(aRows, k, aCols)},
+	)
+	if trackError {
+		program = append(program,
+			desStep{phase: phaseError, flops: betaErrorFlops(aRows, aCols)},
+			desStep{phase: phaseError, ops: allReduceOps(allReduceAlgo, id, numNodes, betaErrorWords), peer: world},
+		)
+	}
+	return prologue, program
+}
+
+// sums - d) & i): row sums of Hji (k x 1), or column sums of Wij (cols), as a 1 x k row
+func (node *Node) sums(X *mat.Dense, cols bool) *mat.Dense {
+	r, c := X.Dims()
+	s := make([]float64, k)
+	node.compute(phaseGram, elemFlops(r, c), func() {
+		for i := 0; i < r; i++ {
+			for j, x := range X.RawRowView(i) {
+				if cols {
+					s[j] += x
+				} else {
+					s[i] += x
+				}
+			}
+		}
+	})
+	return mat.NewDense(1, k, s)
+}
+
+// broadcastRows - rows copies of the 1 x k row s
+func broadcastRows(s *mat.Dense, rows int) *mat.Dense {
+	out := mat.NewDense(rows, k, nil)
+	for i := 0; i < rows; i++ {
+		out.SetRow(i, s.RawRowView(0))
+	}
+	return out
+}
+
+// betaRatios - a): R = A * WH^(b-2) & (unless sums) S = WH^(b-1), WH floored at nmfcore.BetaEps
+func betaRatios(A mat.Matrix, WH, R, S *mat.Dense, sums bool) {
+	rows, cols := WH.Dims()
+	if R.IsEmpty() {
+		R.ReuseAs(rows, cols)
+	}
+	if !sums && S.IsEmpty() {
+		S.ReuseAs(rows, cols)
+	}
+	for i := 0; i < rows; i++ {
+		r := R.RawRowView(i)
+		var t []float64
+		if !sums {
+			t = S.RawRowView(i)
+		}
+		for j, y := range WH.RawRowView(i) {
+			y = max(y, nmfcore.BetaEps)
+			a := A.At(i, j)
+			switch betaDiv {
+			case 1:
+				r[j] = a / y // sums, no S
+			case 2:
+				r[j], t[j] = a, y
+			case 0:
+				r[j], t[j] = a/(y*y), 1/y
+			default:
+				p := math.Pow(y, betaDiv-2)
+				r[j], t[j] = a*p, p*y
+			}
+		}
+	}
+}
+
+// FLOPs of a) & b) on a rows x cols piece: the powers (a Pow counts as 1) & the products
+func betaProductFlops(rows, cols int, sums bool) float64 {
+	if sums {
+		return 2*elemFlops(rows, cols) + mulFlops(rows, cols, k)
+	}
+	return 4*elemFlops(rows, cols) + 2*mulFlops(rows, cols, k)
+}
+
+// FLOPs of betaUpdate on a block with n rows of W (columns of H): divide, power & multiply per element
+func betaUpdateFlops(n int) float64 {
+	return 3 * elemFlops(n, k)
+}
+
+// e) & j) - X = X * (numer / denom)^g
+// 		X, numer & denom dims = (m/p) x k for W, k x (n/p) for H
+func betaUpdate(X *mat.Dense, numer, denom mat.Matrix) {
+	rows, _ := X.Dims()
+	for i := 0; i < rows; i++ {
+		x := X.RawRowView(i)
+		for j := range x {
+			ratio := numer.At(i, j) / denom.At(i, j)
+			if betaGamma != 1 {
+				ratio = math.Pow(ratio, betaGamma)
+			}
+			x[j] *= ratio
+		}
+	}
+}
+
+// betaErrorFlops - FLOPs of a node's share of the divergence on a rows x cols piece,
+// about 5 per element (a Pow or Log counts as 1)
+func betaErrorFlops(rows, cols int) float64 {
+	return 5 * elemFlops(rows, cols)
+}
+
+// checkBetaConvergence - D_b(A || W H), the sum of d_b over the entries, after iteration
+// iter, & whether to stop (collective over the world). Each node adds up its aPiece.
+func (node *Node) checkBetaConvergence(cv *convergence, iter int, WH *mat.Dense) string {
+	aRows, aCols := node.aPiece.Dims()
+	local := make([]float64, betaErrorWords)
+	node.compute(phaseError, betaErrorFlops(aRows, aCols), func() {
+		for i := 0; i < aRows; i++ {
+			for j, y := range WH.RawRowView(i) {
+				local[0] += nmfcore.BetaDivergence(node.aPiece.At(i, j), y, betaDiv)
+			}
+		}
+	})
+	sums, overBudget := node.sumObjective(cv, local)
+	return node.decide(cv, iter, nmfcore.BetaName(betaDiv), sums[0], overBudget)
+}
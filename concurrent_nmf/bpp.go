@@ -0,0 +1,45 @@
+package main
+
+import (
+	"569-final-project/nmfcore"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// ANLS with block principal pivoting (BPP) - the update rule of MPI-FAUN's main runs
+// Lines 8 & 14 solve their nonnegative least squares problems exactly:
+//
+//	min ||H^T W^T - A^T|| 	over W >= 0 	from H Ht (HGramMat) & A Ht (HProductMatij)
+//	min ||W H - A|| 		over H >= 0 	from Wt W (WGramMat) & Wt A (WProductMatji)
+//
+// Both are one k x k Gram matrix G & a k x r right-hand side R. Each column of X
+// (row of W, column of H) is its own problem, so every node solves for its own
+// rows/columns alone, with the solver in nmfcore/nnls.go.
+
+// FLOPs of nmfcore.NNLS for r columns - a model, the real count depends on the data:
+// a few rounds (bppRoundsModel), each a Cholesky of G_PP (k^3/3, shared by a group),
+// 2 triangular solves (2k^2 per column) & G X (2k^2 per column)
+const bppRoundsModel = 3
+
+func bppFlops(r int) float64 {
+	kf := float64(k)
+	return bppRoundsModel * (kf*kf*kf/3 + 4*kf*kf*float64(r))
+}
+
+// Line 8 of MPI-FAUN - ANLS-BPP, on Wt (each row of W is a column of X)
+// 		W dims = (m/p) x k
+// 		HGramMat dims = k x k
+// 		HProductMatij dims = (m/p) x k
+func bppUpdateW(W *mat.Dense, HGramMat *mat.Dense, HProductMatij mat.Matrix) {
+	Wt := mat.DenseCopyOf(W.T())
+	nmfcore.NNLS(HGramMat, HProductMatij.T(), Wt)
+	W.Copy(Wt.T())
+}
+
+// Line 14 of MPI-FAUN - ANLS-BPP
+// 		H dims = k x (n/p)
+// 		WGramMat dims = k x k
+// 		WProductMatji dims = k x (n/p)
+func bppUpdateH(H *mat.Dense, WGramMat *mat.Dense, WProductMatji mat.Matrix) {
+	nmfcore.NNLS(WGramMat, WProductMatji, H)
+}
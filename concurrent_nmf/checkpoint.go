@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Checkpoints
+// With -checkpoint dir, every node writes its Wij & Hji to dir when it's done, one
+// checksummed wire format message each (see wire.go), the iteration field = how
+// many iterations the blocks have had. -resume dir starts from a checkpoint of
+// the same m, n, k & grid instead of the random init, & keeps counting from there.
+var checkpointDir, resumeDir string
+
+func checkpointPath(dir, factor string, id int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s_%d.nmfm", factor, id))
+}
+
+// saveBlock - write msg to path, through a temp file so a crash never leaves half a block
+func saveBlock(path string, msg MatMessage) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	_, err = writeMessage(w, msg, true, &WireStats{})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err = errors.Join(err, f.Close()); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// loadBlock - read a block written by saveBlock
+func loadBlock(path string) (MatMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return MatMessage{}, err
+	}
+	defer f.Close()
+	msg, _, err := readMessage(bufio.NewReader(f), &WireStats{})
+	if err != nil {
+		return msg, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return msg, nil
+}
+
+// saveCheckpoint - write the node's Wij & Hji, after iters iterations, to dir
+func (node *Node) saveCheckpoint(dir string, Wij, Hji *mat.Dense, iters int) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	id := node.nodeID
+	err := saveBlock(checkpointPath(dir, "W", id), MatMessage{mtx: *Wij, sentID: id, epoch: iters, isFinalW: true})
+	if err != nil {
+		return err
+	}
+	return saveBlock(checkpointPath(dir, "H", id), MatMessage{mtx: *Hji, sentID: id, epoch: iters, isFinalH: true})
+}
+
+// loadCheckpoint - the node's Wij & Hji from dir, & the iterations they've had
+func (node *Node) loadCheckpoint(dir string) (Wij, Hji mat.Dense, iters int, err error) {
+	id := node.nodeID
+	w, err := loadBlock(checkpointPath(dir, "W", id))
+	if err != nil {
+		return Wij, Hji, 0, err
+	}
+	h, err := loadBlock(checkpointPath(dir, "H", id))
+	if err != nil {
+		return Wij, Hji, 0, err
+	}
+
+	// blocks of another node, grid or k would silently give garbage
+	wr, wc := w.mtx.Dims()
+	hr, hc := h.mtx.Dims()
+	switch {
+	case !w.isFinalW || !h.isFinalH || w.sentID != id || h.sentID != id:
+		return Wij, Hji, 0, fmt.Errorf("checkpoint in %s doesn't hold node %d's W & H", dir, id)
+	case wr != wRows[id] || wc != k || hr != k || hc != hCols[id]:
+		return Wij, Hji, 0, fmt.Errorf("checkpoint in %s has node %d's W %d x %d & H %d x %d, want %d x %d & %d x %d",
+			dir, id, wr, wc, hr, hc, wRows[id], k, k, hCols[id])
+	case w.epoch != h.epoch:
+		return Wij, Hji, 0, fmt.Errorf("checkpoint in %s has node %d's W after %d iterations but H after %d",
+			dir, id, w.epoch, h.epoch)
+	}
+	return w.mtx, h.mtx, w.epoch, nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Collectives on real Communicators
+// Every collective, with every algorithm & in both send modes, on worlds of 1 to 9
+// goroutines over the chan transport, checked against the answer worked out
+// directly - plus that nobody's input got changed under it. All values are small
+// integers, so sums come out exact in any order. Run with -race, share mode is only
+// right if nobody writes what another member still reads.
+const maxWorld = 9
+
+// onEach - run f on every member of a new world of size goroutines, wait for all
+func onEach(size int, f func(c *Communicator)) {
+	comms := makeWorldComms(makeChanTransports(makeMatrixChans(size)))
+	var done sync.WaitGroup
+	for _, c := range comms {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			f(c)
+		}()
+	}
+	done.Wait()
+}
+
+// inModes - run f once per send mode
+func inModes(t *testing.T, f func(t *testing.T)) {
+	saved := sendMode
+	defer func() { sendMode = saved }()
+	for _, mode := range sendModes {
+		sendMode = mode
+		t.Run(mode, f)
+	}
+}
+
+// TestAllReduce - small (latency bound) & large matrices, so auto tries both sides
+func TestAllReduce(t *testing.T) {
+	inModes(t, func(t *testing.T) {
+		for _, algo := range allReduceAlgos {
+			for size := 1; size <= maxWorld; size++ {
+				for _, rows := range []int{1, 40} {
+					parts, inputs := make([]*mat.Dense, size), make([]*mat.Dense, size)
+					want := mat.NewDense(rows, 8, nil)
+					for r := range parts {
+						data := make([]float64, rows*8)
+						for j := range data {
+							data[j] = float64(r*100 + j)
+						}
+						parts[r] = mat.NewDense(rows, 8, data)
+						inputs[r] = mat.DenseCopyOf(parts[r])
+						want.Add(want, parts[r])
+					}
+
+					results := make([]*mat.Dense, size)
+					onEach(size, func(c *Communicator) {
+						results[c.Rank()] = c.allReduce(parts[c.Rank()], algo)
+					})
+					for r := range results {
+						if !mat.Equal(results[r], want) {
+							t.Errorf("%s, %d members, %d x 8: rank %d got the wrong sum", algo, size, rows, r)
+						}
+						if !mat.Equal(parts[r], inputs[r]) {
+							t.Errorf("%s, %d members, %d x 8: rank %d's input changed", algo, size, rows, r)
+						}
+					}
+				}
+			}
+		}
+	})
+}
+
+// TestAllGather - ragged blocks, small & large
+func TestAllGather(t *testing.T) {
+	inModes(t, func(t *testing.T) {
+		for _, algo := range allGatherAlgos {
+			for size := 1; size <= maxWorld; size++ {
+				for _, scale := range []int{1, 100} {
+					counts := make([]int, size)
+					mine, inputs := make([][]float64, size), make([][]float64, size)
+					for r := range counts {
+						counts[r] = ((r*5)%3 + 1) * scale
+						mine[r] = make([]float64, counts[r])
+						for j := range mine[r] {
+							mine[r][j] = float64(r*1000 + j)
+						}
+						inputs[r] = append([]float64(nil), mine[r]...)
+					}
+
+					results := make([][]float64, size)
+					onEach(size, func(c *Communicator) {
+						results[c.Rank()], _ = c.allGatherv(mine[c.Rank()], counts, algo)
+					})
+					name := fmt.Sprintf("%s, %d members, scale %d", algo, size, scale)
+					for r := range results {
+						off := 0
+						for from := range counts {
+							for j := 0; j < counts[from]; j++ {
+								if results[r][off+j] != float64(from*1000+j) {
+									t.Errorf("%s: rank %d got the wrong block from rank %d", name, r, from)
+									break
+								}
+							}
+							off += counts[from]
+						}
+						for j := range mine[r] {
+							if mine[r][j] != inputs[r][j] {
+								t.Errorf("%s: rank %d's input changed", name, r)
+								break
+							}
+						}
+					}
+				}
+			}
+		}
+	})
+}
+
+// TestReduceScatter - ragged blocks, small & large (the input is scratch space)
+func TestReduceScatter(t *testing.T) {
+	inModes(t, func(t *testing.T) {
+		for _, algo := range reduceScatterAlgos {
+			for size := 1; size <= maxWorld; size++ {
+				for _, scale := range []int{1, 100} {
+					counts := make([]int, size)
+					for r := range counts {
+						counts[r] = ((r*7)%4 + 1) * scale
+					}
+					offsets := countOffsets(counts)
+					datas := make([][]float64, size)
+					want := make([]float64, offsets[size])
+					for r := range datas {
+						datas[r] = make([]float64, offsets[size])
+						for j := range datas[r] {
+							datas[r][j] = float64(r*1000 + j)
+							want[j] += datas[r][j]
+						}
+					}
+
+					results := make([][]float64, size)
+					onEach(size, func(c *Communicator) {
+						results[c.Rank()] = c.reduceScatterv(datas[c.Rank()], counts, algo)
+					})
+					for r := range results {
+						if len(results[r]) != counts[r] {
+							t.Errorf("%s, %d members, scale %d: rank %d got %d words, want %d", algo, size, scale, r, len(results[r]), counts[r])
+							continue
+						}
+						for j, v := range results[r] {
+							if v != want[offsets[r]+j] {
+								t.Errorf("%s, %d members, scale %d: rank %d got the wrong sum", algo, size, scale, r)
+								break
+							}
+						}
+					}
+				}
+			}
+		}
+	})
+}
+
+// TestSendRecv - messages around a ring, sent in the reverse of the order they're
+// received in, so they only come out right if tags & epochs are matched
+func TestSendRecv(t *testing.T) {
+	inModes(t, func(t *testing.T) {
+		for size := 2; size <= maxWorld; size++ {
+			var wrong atomic.Int32
+			onEach(size, func(c *Communicator) {
+				right, left := (c.Rank()+1)%size, (c.Rank()+size-1)%size
+				for epoch := 1; epoch >= 0; epoch-- {
+					c.SetEpoch(epoch)
+					for tag := 1; tag >= 0; tag-- {
+						c.Send(right, tag, mat.NewDense(1, 3, []float64{float64(c.Rank()), float64(epoch), float64(tag)}))
+					}
+				}
+				for epoch := 0; epoch <= 1; epoch++ {
+					c.SetEpoch(epoch)
+					for tag := 0; tag <= 1; tag++ {
+						got := c.Recv(left, tag)
+						if !mat.Equal(&got, mat.NewDense(1, 3, []float64{float64(left), float64(epoch), float64(tag)})) {
+							wrong.Add(1)
+						}
+					}
+				}
+			})
+			if n := wrong.Load(); n > 0 {
+				t.Errorf("%d members: %d messages matched wrong", size, n)
+			}
+		}
+	})
+}
+
+// TestNodeCollectives - the grid collectives of parallelNMF on ragged grids, for a
+// few iterations that write the same Wij, Hji, Vij & Yij over again like parallelNMF
+// does: after the all-reduce that follows, & poisoned with NaN first (see
+// TestShareModeReuse). Checks the gathered Wi & Hj against W & H & the scattered
+// pieces against the sums over the grid row (column), with the packing of Yij's
+// columns.
+func TestNodeCollectives(t *testing.T) {
+	savedGather, savedScatter := allGatherAlgo, reduceScatterAlgo
+	defer func() { allGatherAlgo, reduceScatterAlgo = savedGather, savedScatter }()
+	k = 3
+	const iters = 3
+
+	// entries of W & H (global rows & columns), of node id's Vij & Yij (local)
+	w := func(iter, row, col int) float64 { return float64(iter*100000 + row*10 + col) }
+	h := func(iter, row, col int) float64 { return float64(iter*100000 - row*1000 - col) }
+	v := func(iter, id, row, col int) float64 { return float64(iter*100000 + id*1000 + row*10 + col) }
+	y := func(iter, id, row, col int) float64 { return float64(iter*100000 - id*1000 + row*100 + col) }
+	fill := func(x *mat.Dense, f func(i, j int) float64) {
+		x.Apply(func(i, j int, _ float64) float64 { return f(i, j) }, x)
+	}
+	poison := func(xs ...*mat.Dense) {
+		for _, x := range xs {
+			fill(x, func(int, int) float64 { return math.NaN() })
+		}
+	}
+
+	inModes(t, func(t *testing.T) {
+		for _, grid := range []struct{ m, n, pr, pc int }{{23, 17, 2, 3}, {23, 17, 3, 2}, {9, 11, 1, 4}, {11, 9, 4, 1}} {
+			for i := range max(len(allGatherAlgos), len(reduceScatterAlgos)) {
+				allGatherAlgo = allGatherAlgos[i%len(allGatherAlgos)]
+				reduceScatterAlgo = reduceScatterAlgos[i%len(reduceScatterAlgos)]
+				setGrid(grid.m, grid.n, grid.pr, grid.pc)
+				name := fmt.Sprintf("%d x %d on %d x %d, %s all-gather, %s reduce-scatter",
+					m, n, numNodeRows, numNodeCols, allGatherAlgo, reduceScatterAlgo)
+
+				var wrongW, wrongH, wrongV, wrongY atomic.Int32
+				onEach(numNodes, func(c *Communicator) {
+					node := makeNode(c, nil, nil, 0)
+					node.splitGrid()
+					id, row, col := node.nodeID, nodeRow(node.nodeID), nodeCol(node.nodeID)
+					aRows, aCols := aPieceRows(id), aPieceCols(id)
+					Wij, Hji := mat.NewDense(wRows[id], k, nil), mat.NewDense(k, hCols[id], nil)
+					Vij, Yij := mat.NewDense(aRows, k, nil), mat.NewDense(k, aCols, nil)
+					one := mat.NewDense(1, 1, []float64{1})
+
+					for iter := 0; iter < iters; iter++ {
+						node.setEpoch(iter)
+						fill(Wij, func(i, j int) float64 { return w(iter, wRowStart[id]+i, j) })
+						fill(Hji, func(i, j int) float64 { return h(iter, i, hColStart[id]+j) })
+						fill(Vij, func(i, j int) float64 { return v(iter, id, i, j) })
+						fill(Yij, func(i, j int) float64 { return y(iter, id, i, j) })
+
+						Hj := node.allGatherAcrossNodeColumns(Hji)
+						Wi := node.allGatherAcrossNodeRows(Wij)
+						Vi := node.reduceScatterAcrossNodeRows(Vij)
+						Yj := node.reduceScatterAcrossNodeColumns(Yij)
+
+						if !matches(Wi, aRows, k, func(i, j int) float64 { return w(iter, aRowOffsets[row]+i, j) }) {
+							wrongW.Add(1)
+						}
+						if !matches(Hj, k, aCols, func(i, j int) float64 { return h(iter, i, aColOffsets[col]+j) }) {
+							wrongH.Add(1)
+						}
+						if !matches(Vi, wRows[id], k, func(i, j int) float64 {
+							total := 0.0
+							for other := 0; other < numNodeCols; other++ {
+								total += v(iter, row*numNodeCols+other, wLocalStart(id)+i, j)
+							}
+							return total
+						}) {
+							wrongV.Add(1)
+						}
+						if !matches(Yj, k, hCols[id], func(i, j int) float64 {
+							total := 0.0
+							for other := 0; other < numNodeRows; other++ {
+								total += y(iter, other*numNodeCols+col, i, hLocalStart(id)+j)
+							}
+							return total
+						}) {
+							wrongY.Add(1)
+						}
+
+						node.allReduce(one)
+						poison(Wij, Hji, Vij, Yij)
+					}
+				})
+				for what, wrong := range map[string]*atomic.Int32{"Wi": &wrongW, "Hj": &wrongH, "Vij pieces": &wrongV, "Yij pieces": &wrongY} {
+					if n := wrong.Load(); n > 0 {
+						t.Errorf("%s: %d wrong %s", name, n, what)
+					}
+				}
+			}
+		}
+	})
+}
+
+// matches - x is r x c with x(i, j) = want(i, j)
+func matches(x mat.Matrix, r, c int, want func(i, j int) float64) bool {
+	if xr, xc := x.Dims(); xr != r || xc != c {
+		return false
+	}
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			if x.At(i, j) != want(i, j) {
+				return false
+			}
+		}
+	}
+	return true
+}
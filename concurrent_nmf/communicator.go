@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Communicator - MPI-like group of nodes that can message each other
+// Each member holds its own *Communicator (its rank differs). Messages go over the
+// node's Transport (see transport.go) & carry the communicator's context id, so a
+// collective over a communicator only ever matches messages from its members.
+//
+//	world 		- all p nodes, rank = nodeID
+//	row comm 	- the p_c nodes in my grid row, rank = my grid column
+//	col comm 	- the p_r nodes in my grid column, rank = my grid row
+type Communicator struct {
+	members []int // world nodeID of each rank
+	ctx     int   // context id, the same on every member
+	rank    int
+	epoch   int        // stamped on what I send, see SetEpoch
+	splits  int        // Splits done so far, for the next context id
+	ep      *endpoint  // shared by all of one node's communicators
+	stats   *CommStats // shared by all of one node's communicators
+	clock   *SimClock  // shared by all of one node's communicators
+}
+
+// Message tags
+// User algorithms pick their own tags >= 0, the collectives use the negative ones.
+const (
+	tagExchange      = -1 - iota // naive collectives
+	tagAllReduce                 // see allreduce.go
+	tagAllGather                 // see allgather.go
+	tagReduceScatter             // see reducescatter.go
+	tagSplit                     // see Split
+	tagBarrier                   // see Barrier
+)
+
+// msgKey - what a receive matches on
+type msgKey struct {
+	comm  int // context id
+	src   int // sender's rank
+	tag   int
+	epoch int
+}
+
+// endpoint - a node's end of the transport
+type endpoint struct {
+	transport Transport
+	pending   map[msgKey][]MatMessage // received early (see recvFrom)
+}
+
+// CommStats - what one node sent, over all its communicators
+type CommStats struct {
+	Messages int
+	Words    int // float64s
+}
+
+// makeWorldComms - world communicator of every node, over the given transports
+func makeWorldComms(transports []Transport) []*Communicator {
+	comms := make([]*Communicator, len(transports))
+	for i := range comms {
+		comms[i] = newWorldComm(transports[i], i, len(transports))
+	}
+	return comms
+}
+
+// newWorldComm - node id's world communicator, out of p nodes
+func newWorldComm(transport Transport, id, p int) *Communicator {
+	members := make([]int, p)
+	for i := range members {
+		members[i] = i
+	}
+	return &Communicator{
+		members: members,
+		rank:    id,
+		ep: &endpoint{
+			transport: transport,
+			pending:   make(map[msgKey][]MatMessage),
+		},
+		stats: &CommStats{},
+		clock: newSimClock(),
+	}
+}
+
+// Size - number of members
+func (c *Communicator) Size() int {
+	return len(c.members)
+}
+
+// Rank - my rank in this communicator
+func (c *Communicator) Rank() int {
+	return c.rank
+}
+
+// WorldID - world nodeID of the member with the given rank
+func (c *Communicator) WorldID(rank int) int {
+	return c.members[rank]
+}
+
+// Split - like MPI_Comm_split, must be called by every member
+// Members with the same color end up in the same new communicator, ranked by key
+// (ties broken by rank in c). A negative color gets no communicator (nil).
+// Everyone tells everyone its color & key, that's setup so it isn't charged to
+// the stats or the simulated clocks.
+func (c *Communicator) Split(color, key int) *Communicator {
+	size := c.Size()
+	colors, keys := make([]int, size), make([]int, size)
+	colors[c.rank], keys[c.rank] = color, key
+
+	mine := mat.NewDense(1, 2, []float64{float64(color), float64(key)})
+	for rank := 0; rank < size; rank++ {
+		if rank != c.rank {
+			c.post(rank, tagSplit, mine, 0)
+		}
+	}
+	for rank := 0; rank < size; rank++ {
+		if rank != c.rank {
+			theirs := c.recvFrom(rank, tagSplit)
+			colors[rank], keys[rank] = int(theirs.At(0, 0)), int(theirs.At(0, 1))
+		}
+	}
+	c.splits++
+
+	if color < 0 {
+		return nil
+	}
+	var ranks []int // ranks in c with my color
+	for rank := range colors {
+		if colors[rank] == color {
+			ranks = append(ranks, rank)
+		}
+	}
+	sort.SliceStable(ranks, func(a, b int) bool {
+		return keys[ranks[a]] < keys[ranks[b]]
+	})
+
+	split := &Communicator{
+		members: make([]int, len(ranks)),
+		ctx:     splitContext(c.ctx, c.splits, color),
+		ep:      c.ep,
+		stats:   c.stats,
+		clock:   c.clock,
+	}
+	for i, rank := range ranks {
+		split.members[i] = c.WorldID(rank)
+		if rank == c.rank {
+			split.rank = i
+		}
+	}
+	return split
+}
+
+// splitContext - context id of a new communicator, worked out the same on every member
+func splitContext(parent, split, color int) int {
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, [3]int64{int64(parent), int64(split), int64(color)})
+	return int(h.Sum64() >> 1)
+}
+
+// SetEpoch - epoch (e.g. iteration) stamped on what I send from now on
+// A receive only matches messages from the same epoch, so a message that shows up
+// early from a node that's already a step ahead waits for its turn.
+func (c *Communicator) SetEpoch(epoch int) {
+	c.epoch = epoch
+}
+
+// Send modes - who owns a matrix once it's been sent
+//
+//	share 	- the receiver gets a view of the sender's matrix & nobody may change it
+//			  anymore (the sender only once every receiver is done with it)
+//	copy 	- the receiver gets its own copy (from the buffer pool, see pool.go), the
+//			  sender can change its matrix right away
+//
+// Over tcp every receiver gets its own copy either way.
+const (
+	sendShare = "share"
+	sendCopy  = "copy"
+)
+
+var sendModes = []string{sendShare, sendCopy}
+
+// Send mode of every send, set from the Config by applyConfig
+var sendMode = sendShare
+
+// Send - point-to-point send of mtx to the member with rank dest, with tag (>= 0)
+// In share mode, don't change mtx afterwards (the receiver may still be reading it).
+func (c *Communicator) Send(dest, tag int, mtx *mat.Dense) {
+	c.send(dest, tag, mtx)
+}
+
+// Recv - point-to-point receive of the next message from rank src with tag (>= 0),
+// sent in my current epoch. In share mode it's the sender's matrix, don't change it.
+func (c *Communicator) Recv(src, tag int) mat.Dense {
+	return c.recvFrom(src, tag)
+}
+
+// send - send mtx to rank dest, by the send mode
+func (c *Communicator) send(dest, tag int, mtx *mat.Dense) {
+	if sendMode == sendCopy {
+		mtx = pooledCopy(mtx)
+	}
+	c.handOff(dest, tag, mtx)
+}
+
+// handOff - send mtx itself to rank dest, whatever the send mode
+// Only for a sender that's done with mtx & hasn't given it to anyone else, the
+// receiver owns it from then on.
+func (c *Communicator) handOff(dest, tag int, mtx *mat.Dense) {
+	if c.clock.setup {
+		// setup, like Split: no stats or simulated time
+		c.post(dest, tag, mtx, 0)
+		return
+	}
+	r, cols := 0, 0
+	if !mtx.IsEmpty() {
+		r, cols = mtx.Dims()
+	}
+	c.stats.Messages++
+	c.stats.Words += r * cols
+
+	// simulated network (see network.go)
+	bytes := 8 * r * cols
+	c.clock.advanceComm(network.sendTime(bytes))
+	arrival := network.arrival(c.WorldID(dest), c.clock.Now, bytes)
+
+	c.post(dest, tag, mtx, arrival)
+}
+
+// post - hand mtx to the transport, no stats or simulated time
+func (c *Communicator) post(dest, tag int, mtx *mat.Dense, arrival float64) {
+	c.ep.transport.Send(c.WorldID(dest), MatMessage{
+		mtx:     *mtx,
+		comm:    c.ctx,
+		sentID:  c.rank,
+		tag:     tag,
+		epoch:   c.epoch,
+		arrival: arrival,
+	})
+}
+
+// recvFrom - receive of the next message from rank src with tag, in my epoch
+// Messages that show up first (other communicator, sender, tag or epoch) are kept
+// in pending, one queue per communicator, sender, tag & epoch, so matching
+// messages are always received in the order they were sent.
+func (c *Communicator) recvFrom(src, tag int) mat.Dense {
+	pending := c.ep.pending
+	want := msgKey{c.ctx, src, tag, c.epoch}
+	if queue := pending[want]; len(queue) > 0 {
+		if len(queue) == 1 {
+			delete(pending, want)
+		} else {
+			pending[want] = queue[1:]
+		}
+		c.clock.waitUntil(queue[0].arrival)
+		return queue[0].mtx
+	}
+	for {
+		next := c.ep.transport.Recv()
+		if key := (msgKey{next.comm, next.sentID, next.tag, next.epoch}); key != want {
+			pending[key] = append(pending[key], next)
+			continue
+		}
+		c.clock.waitUntil(next.arrival)
+		return next.mtx
+	}
+}
+
+// exchange - every member sends its part to every other member
+// Returns all members' parts, indexed by rank. In share mode they're the other
+// members' own matrices, only read them, & recycle them when done.
+func (c *Communicator) exchange(part *mat.Dense) []mat.Dense {
+	size := c.Size()
+
+	// send out my part
+	for rank := 0; rank < size; rank++ {
+		if rank != c.rank {
+			c.send(rank, tagExchange, part)
+		}
+	}
+
+	parts := make([]mat.Dense, size)
+	parts[c.rank] = *part
+
+	// get parts from each other member
+	for rank := 0; rank < size; rank++ {
+		if rank != c.rank {
+			parts[rank] = c.recvFrom(rank, tagExchange)
+		}
+	}
+
+	return parts
+}
+
+// shareBarrier - Barrier for share mode's sake, not charged (see handOff)
+// A real network copies a message out of the sender's buffer, so the waiting it does
+// isn't on the simulated clocks or in the stats, & both send modes report the same.
+func (c *Communicator) shareBarrier() {
+	setup := c.clock.setup
+	c.clock.setup = true
+	c.Barrier()
+	c.clock.setup = setup
+}
+
+// recycle - give what exchange received back to the buffer pool, once done with it
+// In share mode the parts are other members' matrices, so it's a barrier instead:
+// it returns once every member is done reading, & everyone can write its part again.
+// exchange is the only place a collective sends the caller's matrix itself (the
+// schedules in schedule.go pack into buffers of their own), so once any collective
+// returns, nobody reads its input anymore.
+func (c *Communicator) recycle(parts []mat.Dense) {
+	if sendMode != sendCopy {
+		c.shareBarrier()
+		return
+	}
+	for rank := range parts {
+		if rank != c.rank {
+			putBuffer(vecData(parts[rank]))
+		}
+	}
+}
+
+// Barrier - like MPI_Barrier, returns once every member has called it
+// Dissemination barrier: in round d, send an empty message to rank+d & wait for
+// the one from rank-d, d = 1, 2, 4 .. - ceil(log2 p) rounds.
+// It replaced the generation-counted barrier (barrier.go) once nodes could be OS
+// processes: that one was a mutex & condition variable all members shared, which
+// only works inside one process. Messages work over any Transport, & their latency
+// lands on the simulated clocks instead of being made up after the fact.
+func (c *Communicator) Barrier() {
+	size := c.Size()
+	for dist := 1; dist < size; dist *= 2 {
+		c.send((c.rank+dist)%size, tagBarrier, &mat.Dense{})
+		c.recvFrom((c.rank-dist+size)%size, tagBarrier)
+	}
+}
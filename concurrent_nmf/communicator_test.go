@@ -0,0 +1,89 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// TestBarrier - nobody leaves a barrier before everyone has arrived, over & over
+func TestBarrier(t *testing.T) {
+	const rounds = 20
+	for size := 1; size <= 9; size++ {
+		var arrived [rounds]atomic.Int32
+		var early atomic.Int32
+		onEach(size, func(c *Communicator) {
+			for round := range arrived {
+				arrived[round].Add(1)
+				c.Barrier()
+				if arrived[round].Load() != int32(size) {
+					early.Add(1)
+				}
+			}
+		})
+		if n := early.Load(); n > 0 {
+			t.Errorf("%d members: left a barrier early %d times", size, n)
+		}
+	}
+}
+
+// TestShareModeReuse - in share mode exchange hands out the senders' own parts, & a
+// member writes its part again right after recycle, poisoning it with NaN first: a
+// receiver that still read it then would see NaN or the next round's values (& the
+// race detector would flag it). Same right after every all-reduce algorithm returns
+// (the naive one sends its input as is).
+func TestShareModeReuse(t *testing.T) {
+	saved := sendMode
+	defer func() { sendMode = saved }()
+	sendMode = sendShare
+
+	const rounds, words = 50, 64
+	for size := 2; size <= 6; size++ {
+		var wrong atomic.Int32
+		onEach(size, func(c *Communicator) {
+			part := mat.NewDense(1, words, nil)
+			fill := func(round int) {
+				for j := 0; j < words; j++ {
+					part.Set(0, j, float64(round*1000+c.Rank()))
+				}
+			}
+			poison := func() {
+				for j := 0; j < words; j++ {
+					part.Set(0, j, math.NaN())
+				}
+			}
+			// sum of round*1000+r over the ranks
+			sum := func(round int) float64 { return float64(size*round*1000 + size*(size-1)/2) }
+
+			for round := 0; round < rounds; round++ {
+				c.SetEpoch(round)
+				fill(round)
+				parts := c.exchange(part)
+				for r := range parts {
+					for _, v := range parts[r].RawRowView(0) {
+						if v != float64(round*1000+r) {
+							wrong.Add(1)
+							break
+						}
+					}
+				}
+				c.recycle(parts)
+				poison()
+
+				for _, algo := range allReduceAlgos {
+					fill(round)
+					got := c.allReduce(part, algo)
+					poison()
+					if got.At(0, 0) != sum(round) || got.At(0, words-1) != sum(round) {
+						wrong.Add(1)
+					}
+				}
+			}
+		})
+		if n := wrong.Load(); n > 0 {
+			t.Errorf("%d members: %d parts read after their sender wrote them again", size, n)
+		}
+	}
+}
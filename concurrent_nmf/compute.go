@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Compute cost model
+// Every local kernel in parallelNMF counts its FLOPs. With a node FLOP rate set,
+// the simulated clock charges flops / rate (a prediction for the target machine),
+// otherwise it charges the time the kernel took on this machine.
+//	Mul (r x c) @ (c x q) 		2rcq
+//	DivElem, MulElem, Add 		1 per element
+
+// Phases of one iteration, the breakdown used in the MPI-FAUN experiments
+const (
+	phaseGram          = "Gram"          // lines 3 & 9
+	phaseAllReduce     = "AllReduce"     // lines 4 & 10
+	phaseAllGather     = "AllGather"     // lines 5 & 11
+	phaseMM            = "MM"            // lines 6 & 12
+	phaseReduceScatter = "ReduceScatter" // lines 7 & 13
+	phaseNLS           = "NLS"           // lines 8 & 14
+	phaseError         = "Error"         // not in the paper's loop, see convergence.go
+)
+
+var phaseOrder = []string{phaseGram, phaseAllReduce, phaseAllGather, phaseMM, phaseReduceScatter, phaseNLS, phaseError}
+
+// Node FLOP rate (FLOP/s) for the compute model, 0 = use measured time.
+// Set from the Config by applyConfig
+var flopRate float64
+
+func mulFlops(r, c, q int) float64 {
+	return 2 * float64(r) * float64(c) * float64(q)
+}
+
+func elemFlops(r, c int) float64 {
+	return float64(r) * float64(c)
+}
+
+// compute - run a local kernel of the given phase & charge it to the simulated clock
+func (node *Node) compute(phase string, flops float64, kernel func()) {
+	clock := node.world.clock
+	clock.phase = phase
+	clock.Flops[phase] += flops
+
+	start := time.Now()
+	kernel()
+	measured := time.Since(start).Seconds()
+
+	if flopRate > 0 {
+		clock.advanceCompute(flops / flopRate)
+	} else {
+		clock.advanceCompute(measured)
+	}
+}
+
+// startPhase - charge the communication that follows to phase
+func (node *Node) startPhase(phase string) {
+	node.world.clock.phase = phase
+}
+
+// printPhases - per-phase breakdown for one node's clock, per iteration
+func printPhases(w io.Writer, clock *SimClock) {
+	iters := max(clock.Iters, 1)
+	fmt.Fprintf(w, "%-14s %12s %8s %14s\n", "phase", "time/iter", "share", "GFLOP/iter")
+	for _, phase := range phaseOrder {
+		t := clock.ByPhase[phase]
+		if phase == phaseError && t == 0 {
+			continue // not tracked
+		}
+		share := 0.0
+		if clock.Now > 0 {
+			share = 100 * t / clock.Now
+		}
+		flops := "-"
+		if f, ok := clock.Flops[phase]; ok {
+			flops = fmt.Sprintf("%.4g", f/float64(iters)/1e9)
+		}
+		fmt.Fprintf(w, "%-14s %12s %7.1f%% %14s\n", phase, formatSeconds(t/float64(iters)), share, flops)
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	"569-final-project/nmfcore"
+)
+
+// Config - run-time settings for one simulation
+// Can come from flags, a JSON config file, or both (flags win over the file)
+type Config struct {
+	M        int   `json:"m"`
+	N        int   `json:"n"`
+	K        int   `json:"k"`
+	NumNodes int   `json:"numNodes"`
+	NodeRows int   `json:"numNodeRows"`
+	NodeCols int   `json:"numNodeCols"`
+	MaxIter  int   `json:"maxIter"`
+	Seed     int64 `json:"seed"`
+
+	// Input, see synth.go
+	Data        string  `json:"data"`        // ramp, synthetic or file
+	Input       string  `json:"input"`       // file: A's file, m & n come from it (see input.go)
+	InputHeader bool    `json:"-"`           // file: the .csv/.tsv has a header line, set by inputDims
+	DataSeed    int64   `json:"dataSeed"`    // synthetic: seed of the planted factors & the noise
+	PlantedRank int     `json:"plantedRank"` // synthetic: rank of the planted factors, 0 = k
+	Sparsity    float64 `json:"sparsity"`    // synthetic: chance an entry of a planted factor is 0
+	Correlation float64 `json:"correlation"` // synthetic: correlation between planted components
+	Noise       string  `json:"noise"`       // synthetic: none, gaussian or poisson
+	NoiseLevel  float64 `json:"noiseLevel"`  // synthetic: noise std over the mean entry of the planted W H
+	Planted     string  `json:"planted"`     // synthetic: dir to save the planted W & H to
+
+	Init  string `json:"init"`  // how W & H start: random, nndsvd, nndsvda, nndsvdar, acol or file (see init.go)
+	InitW string `json:"initW"` // file: text file of the initial W (m x k)
+	InitH string `json:"initH"` // file: text file of the initial H (k x n)
+
+	Objective string  `json:"objective"` // frobenius, kl or beta (see beta.go)
+	BetaDiv   float64 `json:"betaDiv"`   // b of the beta objective (beta is the network's)
+	Exponent  string  `json:"exponent"`  // exponent of the beta-divergence updates: mm or heuristic
+	Update    string  `json:"update"`    // update rule for W & H, see update.go
+
+	// Convergence, see convergence.go
+	TrackError bool    `json:"trackError"` // print the objective every iteration
+	Tol        float64 `json:"tol"`        // stop at this objective, 0 = don't
+	RelTol     float64 `json:"relTol"`     // stop when the objective changes by less than this fraction, 0 = don't
+	Budget     float64 `json:"budget"`     // stop after this many seconds, 0 = don't
+
+	// Collective algorithms
+	AllReduce     string `json:"allReduce"`     // see allreduce.go
+	AllGather     string `json:"allGather"`     // see allgather.go
+	ReduceScatter string `json:"reduceScatter"` // see reducescatter.go
+	Reproducible  bool   `json:"reproducible"`  // reduce in rank order whatever the algorithms, see allreduce.go
+
+	// Network model, see network.go
+	Alpha      float64 `json:"alpha"` // seconds per message
+	Beta       float64 `json:"beta"`  // seconds per byte
+	Contention bool    `json:"contention"`
+
+	FlopRate float64 `json:"flopRate"` // FLOP/s per node, 0 = measure compute (see compute.go)
+	Engine   string  `json:"engine"`   // goroutine or des (see des.go)
+
+	Transport string `json:"transport"` // chan or tcp (see transport.go)
+	Port      int    `json:"port"`      // tcp: node i listens on port+i
+	Rank      int    `json:"-"`         // tcp: set for the node processes by the launcher
+	Checksum  bool   `json:"checksum"`  // tcp: checksum message payloads (see wire.go)
+	SendMode  string `json:"sendMode"`  // share or copy (see communicator.go)
+
+	Checkpoint string `json:"checkpoint"` // dir to write the final W & H blocks to (see checkpoint.go)
+	Resume     string `json:"resume"`     // dir of a checkpoint to start from
+
+	ConfigPath string `json:"-"`
+	DryRun     bool   `json:"-"`
+
+	CrossCheck bool    `json:"-"`
+	CrossTol   float64 `json:"-"` // see crosscheck.go
+}
+
+// Problem size & processor grid, set from the Config by applyConfig
+var m, n, k int
+var numNodes, numNodeRows, numNodeCols int
+
+// Old defaults, from when these were consts
+//const m, n, k = 16384, 8192, 400
+//const numNodes, numNodeRows, numNodeCols = 512, 32, 16
+
+func defaultConfig() Config {
+	return Config{
+		M:        2048,
+		N:        1024,
+		K:        400,
+		NumNodes: 128,
+		NodeRows: 0, // 0 = let the grid planner pick
+		NodeCols: 0,
+		MaxIter:  100,
+		Seed:     1,
+
+		Data:     dataRamp,
+		DataSeed: 1,
+		Noise:    noiseNone,
+
+		Init: nmfcore.InitRandom,
+
+		Objective: objectiveFrobenius,
+		BetaDiv:   1,
+		Exponent:  nmfcore.ExponentMM,
+		Update:    updateMU,
+
+		AllReduce:     allReduceAuto,
+		AllGather:     allGatherAuto,
+		ReduceScatter: reduceScatterAuto,
+
+		Alpha: 2e-6,  // 2µs latency
+		Beta:  1e-10, // 10 GB/s
+
+		Engine: engineGoroutine,
+
+		Transport: transportChan,
+		Port:      7100,
+		Rank:      -1,
+		SendMode:  sendShare,
+
+		CrossTol: 1e-9,
+	}
+}
+
+func newFlagSet(cfg *Config) *flag.FlagSet {
+	fs := flag.NewFlagSet("concurrent_nmf", flag.ContinueOnError)
+	fs.StringVar(&cfg.ConfigPath, "config", cfg.ConfigPath, "JSON config file (flags override its values)")
+	fs.IntVar(&cfg.M, "m", cfg.M, "rows of A")
+	fs.IntVar(&cfg.N, "n", cfg.N, "columns of A")
+	fs.IntVar(&cfg.K, "k", cfg.K, "rank of the factorization")
+	fs.IntVar(&cfg.NumNodes, "p", cfg.NumNodes, "number of nodes")
+	fs.IntVar(&cfg.NodeRows, "pr", cfg.NodeRows, "rows in the processor grid (0 = planner picks)")
+	fs.IntVar(&cfg.NodeCols, "pc", cfg.NodeCols, "columns in the processor grid (0 = planner picks)")
+	fs.IntVar(&cfg.MaxIter, "iters", cfg.MaxIter, "number of NMF iterations")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed for random initialization")
+	fs.StringVar(&cfg.Data, "data", cfg.Data, "input A: ramp (A[i][j] = i*n + j), synthetic (planted W H + noise, see -plantedrank, -sparsity, -correlation, -noise) or file (see -input)")
+	fs.StringVar(&cfg.Input, "input", cfg.Input, "-data file: A's file, .mtx (Matrix Market), .csv, .tsv or .npy; sets m & n")
+	fs.Int64Var(&cfg.DataSeed, "dataseed", cfg.DataSeed, "-data synthetic: seed of the planted factors & the noise")
+	fs.IntVar(&cfg.PlantedRank, "plantedrank", cfg.PlantedRank, "-data synthetic: rank of the planted factors (0 = k)")
+	fs.Float64Var(&cfg.Sparsity, "sparsity", cfg.Sparsity, "-data synthetic: fraction of the planted factors' entries that are 0")
+	fs.Float64Var(&cfg.Correlation, "correlation", cfg.Correlation, "-data synthetic: correlation between the planted components, in [0, 1)")
+	fs.StringVar(&cfg.Noise, "noise", cfg.Noise, "-data synthetic: noise on A: none, gaussian or poisson")
+	fs.Float64Var(&cfg.NoiseLevel, "noiselevel", cfg.NoiseLevel, "-data synthetic: noise std over the mean entry of the planted W H")
+	fs.StringVar(&cfg.Planted, "planted", cfg.Planted, "-data synthetic: save the planted W & H to W.txt & H.txt in this directory")
+	fs.StringVar(&cfg.Init, "init", cfg.Init, "initial W & H: random (uniform), nndsvd, nndsvda, nndsvdar, acol (random Acol) or file (see -initw, -inith)")
+	fs.StringVar(&cfg.InitW, "initw", cfg.InitW, "-init file: text file of W (m x k), a row a line")
+	fs.StringVar(&cfg.InitH, "inith", cfg.InitH, "-init file: text file of H (k x n), a row a line")
+	fs.StringVar(&cfg.Objective, "objective", cfg.Objective, "objective: frobenius (||A-WH||), kl (KL divergence) or beta (beta divergence, see -betadiv); all but frobenius only have multiplicative updates")
+	fs.Float64Var(&cfg.BetaDiv, "betadiv", cfg.BetaDiv, "beta of -objective beta: 2 Euclidean, 1 KL, 0 Itakura-Saito, or any other")
+	fs.StringVar(&cfg.Exponent, "exponent", cfg.Exponent, "exponent of the beta-divergence updates: mm (majorization-minimization, never goes up) or heuristic (1)")
+	fs.StringVar(&cfg.Update, "update", cfg.Update, "update rule for W & H: mu (multiplicative), hals or bpp (ANLS)")
+	fs.BoolVar(&cfg.TrackError, "trackerror", cfg.TrackError, "print the objective every iteration (relative error ||A-WH||/||A||, or the divergence)")
+	fs.Float64Var(&cfg.Tol, "tol", cfg.Tol, "stop once the objective is at most this (0 = run all iterations)")
+	fs.Float64Var(&cfg.RelTol, "reltol", cfg.RelTol, "stop once the objective changes by at most this fraction in an iteration (0 = off)")
+	fs.Float64Var(&cfg.Budget, "budget", cfg.Budget, "stop after the iteration that runs past this many seconds of wall-clock (0 = off)")
+	fs.StringVar(&cfg.AllReduce, "allreduce", cfg.AllReduce, "all-reduce algorithm: naive, ring, rd, rh or auto")
+	fs.StringVar(&cfg.AllGather, "allgather", cfg.AllGather, "all-gather algorithm: naive, ring, bruck or auto")
+	fs.StringVar(&cfg.ReduceScatter, "reducescatter", cfg.ReduceScatter, "reduce-scatter algorithm: naive, pairwise, rh or auto")
+	fs.BoolVar(&cfg.Reproducible, "reproducible", cfg.Reproducible, "add up every reduction in rank order (naive all-reduce & reduce-scatter), so W & H don't depend on the collective algorithms")
+	fs.Float64Var(&cfg.Alpha, "alpha", cfg.Alpha, "network latency, seconds per message")
+	fs.Float64Var(&cfg.Beta, "beta", cfg.Beta, "network inverse bandwidth, seconds per byte")
+	fs.BoolVar(&cfg.Contention, "contention", cfg.Contention, "messages to the same node share its incoming link")
+	fs.Float64Var(&cfg.FlopRate, "floprate", cfg.FlopRate, "node FLOP/s for predicted compute time (0 = measure on this machine)")
+	fs.StringVar(&cfg.Engine, "engine", cfg.Engine, "goroutine (real math) or des (discrete-event, timing only, needs -floprate)")
+	fs.StringVar(&cfg.Transport, "transport", cfg.Transport, "chan (goroutines) or tcp (a process per node on localhost)")
+	fs.IntVar(&cfg.Port, "port", cfg.Port, "tcp: node i listens on 127.0.0.1:port+i, the launcher on port+p")
+	fs.IntVar(&cfg.Rank, "rank", cfg.Rank, "tcp: run as node rank (the launcher sets this)")
+	fs.BoolVar(&cfg.InputHeader, "inputheader", cfg.InputHeader, "tcp: -input has a header line (the launcher sets this)")
+	fs.StringVar(&cfg.SendMode, "sendmode", cfg.SendMode, "share (receivers get read-only views of sent matrices) or copy (copy-on-send)")
+	fs.BoolVar(&cfg.Checksum, "checksum", cfg.Checksum, "tcp: send a CRC-32C with every message payload & check it on arrival")
+	fs.StringVar(&cfg.Checkpoint, "checkpoint", cfg.Checkpoint, "write every node's final W & H blocks to this directory")
+	fs.StringVar(&cfg.Resume, "resume", cfg.Resume, "start from the W & H blocks checkpointed in this directory (same m, n, k & grid)")
+	fs.BoolVar(&cfg.DryRun, "plan", cfg.DryRun, "dry run: print the ranking of processor grids and exit")
+	fs.BoolVar(&cfg.CrossCheck, "crosscheck", cfg.CrossCheck, "check W & H against a sequential run every iteration, with every collective algorithm, and exit")
+	fs.Float64Var(&cfg.CrossTol, "crosstol", cfg.CrossTol, "-crosscheck: largest relative deviation max|W - W_seq| / max|W_seq| (& for H) let through")
+	return fs
+}
+
+// parseConfig - defaults, then config file (if any), then command-line flags
+func parseConfig(args []string) (Config, error) {
+	cfg := defaultConfig()
+	fs := newFlagSet(&cfg)
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	given := make(map[string]bool) // keys of the config file & flags set
+	if cfg.ConfigPath != "" {
+		keys, err := loadConfigFile(cfg.ConfigPath, &cfg)
+		if err != nil {
+			return cfg, err
+		}
+		given = keys
+		// Parse again so flags given on the command line take precedence over the file
+		fs = newFlagSet(&cfg)
+		if err := fs.Parse(args); err != nil {
+			return cfg, err
+		}
+	}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	// tcp node processes get m, n & the header from the launcher (see launch), so
+	// only the launcher reads through the file
+	if cfg.Data == dataFile && cfg.Rank < 0 {
+		if err := cfg.inputDims(given["m"], given["n"]); err != nil {
+			return cfg, err
+		}
+	}
+	if err := cfg.resolveGrid(); err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.validate()
+}
+
+// resolveGrid - fill in p_r and/or p_c when left at 0
+// Both 0: take the planner's best grid. One 0: the other is p / given.
+func (cfg *Config) resolveGrid() error {
+	if cfg.NumNodes <= 0 || cfg.NodeRows < 0 || cfg.NodeCols < 0 {
+		return nil // validate reports these
+	}
+	switch {
+	case cfg.NodeRows == 0 && cfg.NodeCols == 0:
+		plans := planGrids(*cfg)
+		if len(plans) == 0 {
+			return fmt.Errorf("no p_r x p_c grid of p = %d nodes fits m = %d, n = %d", cfg.NumNodes, cfg.M, cfg.N)
+		}
+		cfg.NodeRows, cfg.NodeCols = plans[0].NodeRows, plans[0].NodeCols
+	case cfg.NodeRows == 0:
+		if cfg.NumNodes%cfg.NodeCols != 0 {
+			return fmt.Errorf("p = %d is not divisible by p_c = %d", cfg.NumNodes, cfg.NodeCols)
+		}
+		cfg.NodeRows = cfg.NumNodes / cfg.NodeCols
+	case cfg.NodeCols == 0:
+		if cfg.NumNodes%cfg.NodeRows != 0 {
+			return fmt.Errorf("p = %d is not divisible by p_r = %d", cfg.NumNodes, cfg.NodeRows)
+		}
+		cfg.NodeCols = cfg.NumNodes / cfg.NodeRows
+	}
+	return nil
+}
+
+// inputDims - m & n (& for .csv/.tsv whether there's a header) of the -input file
+// An m or n given too has to be the file's.
+func (cfg *Config) inputDims(mGiven, nGiven bool) error {
+	if cfg.Input == "" {
+		return fmt.Errorf("data file needs -input")
+	}
+	r, err := openInput(cfg.Input)
+	if err != nil {
+		return err
+	}
+	rows, cols := r.Dims()
+	if mGiven && cfg.M != rows {
+		return fmt.Errorf("%s has %d rows, not m = %d (leave out m, it comes from the file)", cfg.Input, rows, cfg.M)
+	}
+	if nGiven && cfg.N != cols {
+		return fmt.Errorf("%s has %d columns, not n = %d (leave out n, it comes from the file)", cfg.Input, cols, cfg.N)
+	}
+	cfg.M, cfg.N = rows, cols
+	if d, ok := r.(*delimited); ok {
+		cfg.InputHeader = d.header
+	}
+	return nil
+}
+
+// loadConfigFile - decode the file into cfg, & return the keys it sets
+func loadConfigFile(path string, cfg *Config) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	keys := make(map[string]bool, len(fields))
+	for key := range fields {
+		keys[strings.ToLower(key)] = true // Decode matches keys regardless of case
+	}
+	return keys, nil
+}
+
+// validate - reject combinations that would otherwise cause slicing panics
+// Constraints (on m,n,p,p_r,p_c):
+// p_r x p_c must = p (grid)
+// every node must own at least 1 row of W & 1 column of H
+//
+//	(blocks can be ragged, see partition.go)
+func (cfg Config) validate() error {
+	var errs []error
+	positive := []struct {
+		name string
+		val  int
+	}{
+		{"m", cfg.M}, {"n", cfg.N}, {"k", cfg.K},
+		{"p", cfg.NumNodes}, {"p_r", cfg.NodeRows}, {"p_c", cfg.NodeCols},
+		{"iters", cfg.MaxIter},
+	}
+	for _, v := range positive {
+		if v.val <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %d", v.name, v.val))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if cfg.NodeRows*cfg.NodeCols != cfg.NumNodes {
+		errs = append(errs, fmt.Errorf("grid %d x %d does not have p = %d nodes", cfg.NodeRows, cfg.NodeCols, cfg.NumNodes))
+	}
+	// smallest row block of A (m/p_r rounded down) gets split across p_c nodes,
+	// smallest col block of A (n/p_c rounded down) gets split across p_r nodes
+	if !gridFits(cfg.M, cfg.N, cfg.NodeRows, cfg.NodeCols) {
+		errs = append(errs, fmt.Errorf("m = %d, n = %d are too small for a %d x %d grid (need m/p_r >= p_c and n/p_c >= p_r)",
+			cfg.M, cfg.N, cfg.NodeRows, cfg.NodeCols))
+	}
+	if cfg.Alpha < 0 || cfg.Beta < 0 {
+		errs = append(errs, fmt.Errorf("alpha & beta can't be negative, got %g, %g", cfg.Alpha, cfg.Beta))
+	}
+	if cfg.Tol < 0 || cfg.RelTol < 0 || cfg.Budget < 0 {
+		errs = append(errs, fmt.Errorf("tol, reltol & budget can't be negative, got %g, %g, %g", cfg.Tol, cfg.RelTol, cfg.Budget))
+	}
+	if cfg.FlopRate < 0 {
+		errs = append(errs, fmt.Errorf("FLOP rate can't be negative, got %g", cfg.FlopRate))
+	}
+	switch cfg.Engine {
+	case engineGoroutine:
+	case engineDES:
+		if cfg.FlopRate == 0 {
+			errs = append(errs, fmt.Errorf("the des engine predicts compute from FLOPs, it needs a FLOP rate"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown engine %q (want one of %v)", cfg.Engine, engines))
+	}
+	switch {
+	case cfg.Transport != transportChan && cfg.Transport != transportTCP:
+		errs = append(errs, fmt.Errorf("unknown transport %q (want one of %v)", cfg.Transport, transports))
+	case cfg.Transport == transportTCP && cfg.Engine == engineDES:
+		errs = append(errs, fmt.Errorf("the des engine doesn't send messages, it can't use the tcp transport"))
+	case cfg.Transport == transportTCP && (cfg.Port <= 0 || cfg.Port+cfg.NumNodes > 65535):
+		errs = append(errs, fmt.Errorf("ports %d to %d aren't all valid", cfg.Port, cfg.Port+cfg.NumNodes))
+	}
+	if cfg.Engine == engineDES && (cfg.Checkpoint != "" || cfg.Resume != "") {
+		errs = append(errs, fmt.Errorf("the des engine has no W or H to checkpoint or resume from"))
+	}
+	if cfg.Engine == engineDES && (cfg.Tol > 0 || cfg.RelTol > 0 || cfg.Budget > 0) {
+		errs = append(errs, fmt.Errorf("the des engine has no error to stop on, it always runs all iterations"))
+	}
+	if cfg.CrossCheck && (cfg.Engine != engineGoroutine || cfg.Transport != transportChan) {
+		errs = append(errs, fmt.Errorf("crosscheck runs the goroutine engine over the chan transport"))
+	}
+	if cfg.CrossTol < 0 {
+		errs = append(errs, fmt.Errorf("crosstol can't be negative, got %g", cfg.CrossTol))
+	}
+	if cfg.Rank >= cfg.NumNodes {
+		errs = append(errs, fmt.Errorf("rank %d out of range for p = %d", cfg.Rank, cfg.NumNodes))
+	}
+	if err := checkAlgo("update", cfg.Update, updateRules); err != nil {
+		errs = append(errs, fmt.Errorf("unknown update rule %q (want one of %v)", cfg.Update, updateRules))
+	}
+	switch {
+	case cfg.Objective != objectiveFrobenius && cfg.Objective != objectiveKL && cfg.Objective != objectiveBeta:
+		errs = append(errs, fmt.Errorf("unknown objective %q (want one of %v)", cfg.Objective, objectives))
+	case cfg.Objective != objectiveFrobenius && cfg.Update != updateMU:
+		errs = append(errs, fmt.Errorf("the %s objective only has multiplicative updates, not %s", cfg.Objective, cfg.Update))
+	}
+	if checkAlgo("data", cfg.Data, dataKinds) != nil {
+		errs = append(errs, fmt.Errorf("unknown data %q (want one of %v)", cfg.Data, dataKinds))
+	}
+	if checkAlgo("noise", cfg.Noise, noiseModels) != nil {
+		errs = append(errs, fmt.Errorf("unknown noise %q (want one of %v)", cfg.Noise, noiseModels))
+	}
+	if cfg.PlantedRank < 0 {
+		errs = append(errs, fmt.Errorf("plantedrank can't be negative, got %d", cfg.PlantedRank))
+	}
+	if !(cfg.Sparsity >= 0 && cfg.Sparsity < 1) || !(cfg.Correlation >= 0 && cfg.Correlation < 1) {
+		errs = append(errs, fmt.Errorf("sparsity & correlation have to be in [0, 1), got %g, %g", cfg.Sparsity, cfg.Correlation))
+	}
+	if !(cfg.NoiseLevel >= 0) || math.IsInf(cfg.NoiseLevel, 0) {
+		errs = append(errs, fmt.Errorf("noiselevel has to be a nonnegative number, got %g", cfg.NoiseLevel))
+	}
+	switch {
+	case checkAlgo("init", cfg.Init, nmfcore.InitMethods) != nil:
+		errs = append(errs, fmt.Errorf("unknown init %q (want one of %v)", cfg.Init, nmfcore.InitMethods))
+	case cfg.Init == nmfcore.InitFile && (cfg.InitW == "" || cfg.InitH == ""):
+		errs = append(errs, fmt.Errorf("init file needs both -initw & -inith"))
+	}
+	if !slices.Contains(nmfcore.Exponents, cfg.Exponent) {
+		errs = append(errs, fmt.Errorf("unknown exponent %q (want one of %v)", cfg.Exponent, nmfcore.Exponents))
+	}
+	if math.IsNaN(cfg.BetaDiv) || math.IsInf(cfg.BetaDiv, 0) {
+		errs = append(errs, fmt.Errorf("betadiv has to be a number, not %g", cfg.BetaDiv))
+	}
+	if cfg.SendMode != sendShare && cfg.SendMode != sendCopy {
+		errs = append(errs, fmt.Errorf("unknown send mode %q (want one of %v)", cfg.SendMode, sendModes))
+	}
+	if cfg.Reproducible && (cfg.AllReduce != allReduceAuto && cfg.AllReduce != allReduceNaive ||
+		cfg.ReduceScatter != reduceScatterAuto && cfg.ReduceScatter != reduceScatterNaive) {
+		errs = append(errs, fmt.Errorf("reproducible runs reduce in rank order with the naive algorithms, not all-reduce %s & reduce-scatter %s",
+			cfg.AllReduce, cfg.ReduceScatter))
+	}
+	if err := checkAlgo("all-reduce", cfg.AllReduce, allReduceAlgos); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkAlgo("all-gather", cfg.AllGather, allGatherAlgos); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkAlgo("reduce-scatter", cfg.ReduceScatter, reduceScatterAlgos); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// collectiveAlgos - the all-reduce, all-gather & reduce-scatter algorithms a run
+// uses: -reproducible sums in rank order with the naive ones
+func (cfg Config) collectiveAlgos() (allReduce, allGather, reduceScatter string) {
+	if cfg.Reproducible {
+		return allReduceNaive, cfg.AllGather, reduceScatterNaive
+	}
+	return cfg.AllReduce, cfg.AllGather, cfg.ReduceScatter
+}
+
+// betaDivergence - b of the beta objective (1 for kl)
+func (cfg Config) betaDivergence() float64 {
+	if cfg.Objective == objectiveKL {
+		return 1
+	}
+	return cfg.BetaDiv
+}
+
+// applyConfig - set the package-level sizes & offset tables used by the nodes
+func applyConfig(cfg Config) {
+	m, n, k = cfg.M, cfg.N, cfg.K
+	numNodes, numNodeRows, numNodeCols = cfg.NumNodes, cfg.NodeRows, cfg.NodeCols
+
+	makePartition()
+
+	allReduceAlgo, allGatherAlgo, reduceScatterAlgo = cfg.collectiveAlgos()
+	objective = cfg.Objective
+	betaDiv = cfg.betaDivergence()
+	betaGamma = nmfcore.BetaExponent(betaDiv, cfg.Exponent)
+	updateRule = cfg.Update
+	network = makeNetwork(cfg)
+	flopRate = cfg.FlopRate
+	wireChecksum = cfg.Checksum
+	sendMode = cfg.SendMode
+	printError = cfg.TrackError
+	stopError, stopChange, stopBudget = cfg.Tol, cfg.RelTol, cfg.Budget
+	trackError = printError || stopError > 0 || stopChange > 0 || stopBudget > 0
+	checkpointDir, resumeDir = cfg.Checkpoint, cfg.Resume
+	initMethod, initWPath, initHPath = cfg.Init, cfg.InitW, cfg.InitH
+	dataKind, dataSeed, plantedDir = cfg.Data, cfg.DataSeed, cfg.Planted
+	inputPath, inputHeader = cfg.Input, cfg.InputHeader
+	plantedRank = cfg.PlantedRank
+	if plantedRank == 0 {
+		plantedRank = k
+	}
+	sparsity, correlation = cfg.Sparsity, cfg.Correlation
+	noiseModel, noiseLevel = cfg.Noise, cfg.NoiseLevel
+}
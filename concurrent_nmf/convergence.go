@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"569-final-project/nmfcore"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Convergence
+// The relative error ||A - WH||_F / ||A||_F, the MPI-FAUN way (see nmfcore/objective.go).
+// After line 14 every node has W^T W (WGramMat, line 10), its block of W^T A
+// (WProductMatji, line 13) & its new Hji, so it has its share of both traces
+// (nmfcore.GramTerms). Each node adds those, ||Aij||^2 & its vote on the time budget
+// into one all-reduce of 4 words. Everyone gets the same sums, so everyone makes the
+// same call on stopping, in the same iteration. The beta-divergence objectives work
+// the same way with their own terms (see beta.go).
+
+// Set from the Config by applyConfig
+var (
+	trackError bool    // work out the objective every iteration
+	printError bool    // & print it (-trackerror)
+	stopError  float64 // stop once the relative error is at most this (-tol)
+	stopChange float64 // stop once the relative error changes by at most this fraction (-reltol)
+	stopBudget float64 // stop after this many seconds of wall-clock (-budget)
+)
+
+const errorWords = 4
+
+// convergence - one node's view of how the run is going
+type convergence struct {
+	start   time.Time
+	normA2  float64 // ||Aij||^2, A doesn't change
+	prevErr float64 // objective after the last iteration, -1 before the first
+}
+
+func (node *Node) newConvergence() *convergence {
+	normA := mat.Norm(node.aPiece, 2) // Frobenius
+	return &convergence{start: time.Now(), normA2: normA * normA, prevErr: -1}
+}
+
+// errorFlops - FLOPs of a node's share of the objective, for an Hji with cols cols:
+// 2 MulElem, 2 Sum & the Mul
+func errorFlops(cols int) float64 {
+	return mulFlops(k, k, cols) + 4*elemFlops(k, cols)
+}
+
+// checkConvergence - relative error of W & H after iteration iter, & whether to stop
+// (collective over the world). Returns why if it's time to stop, else "".
+func (node *Node) checkConvergence(cv *convergence, iter int, WGramMat *mat.Dense, WProductMatji mat.Matrix, Hji *mat.Dense) string {
+	// local terms
+	local := make([]float64, errorWords)
+	node.compute(phaseError, errorFlops(hCols[node.nodeID]), func() {
+		cross, quad := nmfcore.GramTerms(WGramMat, WProductMatji, Hji)
+		copy(local, []float64{cv.normA2, cross, quad})
+	})
+	sums, overBudget := node.sumObjective(cv, local)
+
+	relErr := nmfcore.RelativeError(sums[0], sums[1], sums[2])
+	return node.decide(cv, iter, nmfcore.RelativeErrorName, relErr, overBudget)
+}
+
+// sumObjective - all-reduce the nodes' terms of the objective, local, whose last
+// word is left for the node's vote on the time budget
+func (node *Node) sumObjective(cv *convergence, local []float64) ([]float64, bool) {
+	if stopBudget > 0 && time.Since(cv.start).Seconds() >= stopBudget {
+		local[len(local)-1] = 1
+	}
+	node.startPhase(phaseError)
+	sums := node.world.allReduce(mat.NewDense(1, len(local), local), allReduceAlgo).RawRowView(0)
+	return sums, sums[len(sums)-1] > 0
+}
+
+// decide - print the objective (called name) after iteration iter, & whether to stop
+// Returns why if it's time to stop, else "".
+func (node *Node) decide(cv *convergence, iter int, name string, value float64, overBudget bool) string {
+	prev := cv.prevErr
+	cv.prevErr = value
+	if printError && node.nodeID == 0 {
+		fmt.Printf("Iteration %d: %s %.6g\n", iter+1, name, value)
+	}
+
+	switch {
+	case stopError > 0 && value <= stopError:
+		return fmt.Sprintf("%s %.6g <= %g", name, value, stopError)
+	case stopChange > 0 && prev > 0 && math.Abs(prev-value)/prev <= stopChange:
+		return fmt.Sprintf("%s changed by %.3g <= %g", name, math.Abs(prev-value)/prev, stopChange)
+	case overBudget:
+		return fmt.Sprintf("over the %gs time budget", stopBudget)
+	}
+	return ""
+}
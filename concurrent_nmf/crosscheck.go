@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"569-final-project/nmfcore"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Cross-check (-crosscheck)
+// Runs the configured problem on the goroutine engine with every node reporting its
+// Wij & Hji after every iteration (see Node.report), & next to it the sequential
+// algorithm of sequential_mu_nmf on the whole matrices, started from the same W & H
+// (the nodes' initial blocks put together). After every iteration it puts W & H
+// together the way main does & prints how far they are from the sequential ones:
+//
+//	max abs = max |W - W_seq| 		max rel = max abs / max |W_seq| 	(& H likewise)
+//
+// Then it does it again with every other all-reduce, all-gather & reduce-scatter
+// algorithm & the other send mode, a line each. It fails if any relative deviation
+// goes over -crosstol. The sequential side is nmfcore's whole-matrix updates
+// (update.go & beta.go), the ones sequential_mu_nmf runs, with none of the update
+// kernels of this package, so it checks those too, along with the collectives, the
+// partition & the assembly. Only bpp shares its NNLS solver (nmfcore.NNLS). Rounding
+// is all that should show up, but bpp's exact NNLS solves blow it up on an
+// ill-conditioned A (the default A has rank 2), so that needs a bigger -crosstol.
+
+// Set by crossCheck: nodes report their blocks every iteration
+var reporting bool
+
+// crossVariant - a run of the cross-check: collective algorithms & send mode
+type crossVariant struct {
+	allReduce, allGather, reduceScatter, sendMode string
+}
+
+func (v crossVariant) String() string {
+	return fmt.Sprintf("all-reduce %s, all-gather %s, reduce-scatter %s, %s mode", v.allReduce, v.allGather, v.reduceScatter, v.sendMode)
+}
+
+// crossCheck - cross-check every variant, per-iteration lines for the configured one, error if any failed
+func crossCheck(w io.Writer, cfg Config) error {
+	saved := crossVariant{allReduceAlgo, allGatherAlgo, reduceScatterAlgo, sendMode}
+	defer func() {
+		allReduceAlgo, allGatherAlgo, reduceScatterAlgo, sendMode = saved.allReduce, saved.allGather, saved.reduceScatter, saved.sendMode
+		reporting = false
+	}()
+	reporting = true
+
+	// the configured run, then one algorithm (or send mode) changed at a time
+	variants := []crossVariant{saved}
+	for _, algo := range allReduceAlgos {
+		if algo != saved.allReduce && (!cfg.Reproducible || algo == allReduceNaive) {
+			variants = append(variants, crossVariant{algo, saved.allGather, saved.reduceScatter, saved.sendMode})
+		}
+	}
+	for _, algo := range allGatherAlgos {
+		if algo != saved.allGather {
+			variants = append(variants, crossVariant{saved.allReduce, algo, saved.reduceScatter, saved.sendMode})
+		}
+	}
+	for _, algo := range reduceScatterAlgos {
+		if algo != saved.reduceScatter && (!cfg.Reproducible || algo == reduceScatterNaive) {
+			variants = append(variants, crossVariant{saved.allReduce, saved.allGather, algo, saved.sendMode})
+		}
+	}
+	for _, mode := range sendModes {
+		if mode != saved.sendMode {
+			variants = append(variants, crossVariant{saved.allReduce, saved.allGather, saved.reduceScatter, mode})
+		}
+	}
+
+	A, err := makeA()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i, v := range variants {
+		allReduceAlgo, allGatherAlgo, reduceScatterAlgo, sendMode = v.allReduce, v.allGather, v.reduceScatter, v.sendMode
+		verbose := w
+		if i > 0 {
+			verbose = io.Discard
+		} else {
+			fmt.Fprintln(w, v)
+		}
+		iters, worst, err := crossCheckRun(verbose, A, cfg)
+		status := "ok"
+		if err != nil {
+			status = "FAILED"
+			errs = append(errs, fmt.Errorf("%v: %w", v, err))
+		}
+		fmt.Fprintf(w, "%-64s %3d iterations, max rel %.3g  %s\n", v, iters, worst, status)
+	}
+	return errors.Join(errs...)
+}
+
+// crossCheckRun - one distributed run next to the sequential one, a line per iteration on w
+// Returns the iterations compared & the largest relative deviation.
+func crossCheckRun(w io.Writer, A *mat.Dense, cfg Config) (int, float64, error) {
+	clientChan := make(chan MatMessage, numNodes*3)
+	piecesOfA := partitionAMatrix(A)
+	worldComms := makeWorldComms(makeChanTransports(makeMatrixChans(numNodes)))
+	for i := 0; i < numNodes; i++ {
+		wg.Add(1)
+		go nmfProgram()(makeNode(worldComms[i], clientChan, piecesOfA[i], cfg.Seed), cfg.MaxIter)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// reports by iteration, compared in order as they complete (every node sends its
+	// reports in order, so iteration i completes before i+1). The final blocks (see
+	// finish) come again after the last report, they fill in nothing new.
+	type report struct {
+		wPieces, hPieces []mat.Dense
+		got              int
+	}
+	reports := make(map[int]*report)
+	var W, H *mat.Dense // sequential, after iter iterations
+	iter, compared, worst := -1, 0, 0.0
+	var err error
+	handle := func(msg MatMessage) {
+		if msg.epoch <= iter {
+			return // final blocks, already compared
+		}
+		r := reports[msg.epoch]
+		if r == nil {
+			r = &report{wPieces: make([]mat.Dense, numNodes), hPieces: make([]mat.Dense, numNodes)}
+			reports[msg.epoch] = r
+		}
+		pieces := r.hPieces
+		if msg.isFinalW {
+			pieces = r.wPieces
+		}
+		if !pieces[msg.sentID].IsEmpty() {
+			return // final blocks
+		}
+		pieces[msg.sentID] = msg.mtx
+		if r.got++; r.got < 2*numNodes {
+			return
+		}
+		delete(reports, msg.epoch)
+
+		Wd, Hd := assembleW(r.wPieces), assembleH(r.hPieces)
+		if W == nil {
+			// the initial blocks, the sequential run starts from them
+			W, H, iter = Wd, Hd, msg.epoch
+			return
+		}
+		for ; iter < msg.epoch; iter++ {
+			sequentialIteration(W, H, A)
+		}
+		wAbs, wRel := deviation(Wd, W)
+		hAbs, hRel := deviation(Hd, H)
+		fmt.Fprintf(w, "Iteration %d: W max abs %.3g, max rel %.3g  H max abs %.3g, max rel %.3g\n", iter, wAbs, wRel, hAbs, hRel)
+		compared++
+		worst = max(worst, wRel, hRel)
+		if err == nil && !(wRel <= cfg.CrossTol && hRel <= cfg.CrossTol) {
+			err = fmt.Errorf("iteration %d: max rel %.3g over %g", iter, max(wRel, hRel), cfg.CrossTol)
+		}
+	}
+	for running := true; running; {
+		select {
+		case msg := <-clientChan:
+			handle(msg)
+		case <-done:
+			running = false
+		}
+	}
+	for len(clientChan) > 0 {
+		handle(<-clientChan)
+	}
+	return compared, worst, err
+}
+
+// sequentialIteration - one iteration of sequential_mu_nmf on the whole W & H
+func sequentialIteration(W, H, A *mat.Dense) {
+	if objective != objectiveFrobenius {
+		nmfcore.BetaUpdateW(W, H, A, betaDiv, betaGamma)
+		nmfcore.BetaUpdateH(H, W, A, betaDiv, betaGamma)
+		return
+	}
+	nmfcore.Iterate(W, H, A, updateRule)
+}
+
+// deviation - max |X - Y| & that over max |Y|
+func deviation(X, Y *mat.Dense) (float64, float64) {
+	diff := &mat.Dense{}
+	diff.Sub(X, Y)
+	abs, top := 0.0, 0.0
+	r, c := X.Dims()
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			abs = max(abs, math.Abs(diff.At(i, j)))
+			top = max(top, math.Abs(Y.At(i, j)))
+		}
+	}
+	if top == 0 {
+		return abs, abs
+	}
+	return abs, abs / top
+}
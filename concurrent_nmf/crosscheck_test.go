@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestCrossCheck - every update rule & objective on a ragged 2 x 3 grid stays with the
+// sequential run (nmfcore's whole-matrix updates), with every collective algorithm &
+// both send modes
+func TestCrossCheck(t *testing.T) {
+	cases := []struct {
+		objective, update string
+		betaDiv           float64
+	}{
+		{objectiveFrobenius, updateMU, 0},
+		{objectiveFrobenius, updateHALS, 0},
+		{objectiveFrobenius, updateBPP, 0},
+		{objectiveKL, updateMU, 0},
+		{objectiveBeta, updateMU, 0.5},
+		{objectiveBeta, updateMU, 3},
+	}
+	for _, tc := range cases {
+		name := fmt.Sprintf("%s %s", tc.objective, tc.update)
+		if tc.objective == objectiveBeta {
+			name = fmt.Sprintf("%s %g", tc.objective, tc.betaDiv)
+		}
+		cfg := defaultConfig()
+		cfg.M, cfg.N, cfg.K = 13, 11, 3
+		cfg.NumNodes, cfg.NodeRows, cfg.NodeCols = 6, 2, 3
+		cfg.MaxIter = 4
+		cfg.Data = dataSynthetic // full rank, so bpp's solves stay well-conditioned
+		cfg.Objective, cfg.Update = tc.objective, tc.update
+		if tc.objective == objectiveBeta {
+			cfg.BetaDiv = tc.betaDiv
+		}
+		if err := cfg.validate(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		applyConfig(cfg)
+
+		var out strings.Builder
+		if err := crossCheck(&out, cfg); err != nil {
+			t.Errorf("%s: %v\n%s", name, err, out.String())
+		}
+		if got := strings.Count(out.String(), "Iteration "); got != cfg.MaxIter {
+			t.Errorf("%s: compared %d iterations of the configured run, want %d", name, got, cfg.MaxIter)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"iter"
+)
+
+// Discrete-event engine
+// One goroutine per node doing the real dense math runs out of memory long before
+// 10k nodes. The des engine replays parallelNMF's schedule instead - the local
+// kernels & the sends/receives of every collective (see schedule.go) - as events
+// on the simulated timeline, without the numerical payload: no A, W or H, only
+// the sizes. Message counts are the same as the goroutine engine's, & so are the
+// simulated times without -contention. With it, messages that compete for a link
+// get it in the order they're sent: simulated-time order here, the order the
+// goroutines happen to run in there, so the times can differ a little.
+//
+// Compute is charged from FLOP counts, so the des engine needs a FLOP rate.
+const (
+	engineGoroutine = "goroutine"
+	engineDES       = "des"
+)
+
+var engines = []string{engineGoroutine, engineDES}
+
+// desStep - one line of MPI-FAUN: a local kernel, or a collective over a communicator
+type desStep struct {
+	phase string
+	flops float64         // kernel
+	ops   iter.Seq[op]    // collective, nil for a kernel
+	peer  func(r int) int // comm rank -> world id
+}
+
+// desProgram - node id's steps run once before the first iteration (prologue) &
+// for one iteration, same order as parallelNMF (or parallelBetaNMF, see beta.go)
+func desProgram(id int) (prologue, program []desStep) {
+	if objective != objectiveFrobenius {
+		return desBetaProgram(id)
+	}
+	row, col := nodeRow(id), nodeCol(id)
+	aRows, aCols := aPieceRows(id), aPieceCols(id)
+	world := func(r int) int { return r }
+	rowComm := func(r int) int { return row*numNodeCols + r }
+	colComm := func(r int) int { return r*numNodeCols + col }
+
+	program = []desStep{
+		// Update W Part
+		// 3)
+		{phase: phaseGram, flops: mulFlops(k, hCols[id], k)},
+		// 4)
+		{phase: phaseAllReduce, ops: allReduceOps(allReduceAlgo, id, numNodes, k*k), peer: world},
+		// 5)
+		{phase: phaseAllGather, ops: allGathervOps(allGatherAlgo, row, hCounts(col)), peer: colComm},
+		// 6)
+		{phase: phaseMM, flops: mulFlops(aRows, aCols, k)},
+		// 7)
+		{phase: phaseReduceScatter, ops: reduceScattervOps(reduceScatterAlgo, col, wCounts(row)), peer: rowComm},
+		// 8)
+		{phase: phaseNLS, flops: updateWFlops(wRows[id])},
+		// Update H Part
+		// 9)
+		{phase: phaseGram, flops: mulFlops(k, wRows[id], k)},
+		// 10)
+		{phase: phaseAllReduce, ops: allReduceOps(allReduceAlgo, id, numNodes, k*k), peer: world},
+		// 11)
+		{phase: phaseAllGather, ops: allGathervOps(allGatherAlgo, col, wCounts(row)), peer: rowComm},
+		// 12)
+		{phase: phaseMM, flops: mulFlops(k, aRows, aCols)},
+		// 13)
+		{phase: phaseReduceScatter, ops: reduceScattervOps(reduceScatterAlgo, row, hCounts(col)), peer: colComm},
+		// 14)
+		{phase: phaseNLS, flops: updateHFlops(hCols[id])},
+	}
+	if trackError {
+		// objective, see convergence.go
+		program = append(program,
+			desStep{phase: phaseError, flops: errorFlops(hCols[id])},
+			desStep{phase: phaseError, ops: allReduceOps(allReduceAlgo, id, numNodes, errorWords), peer: world},
+		)
+	}
+	return nil, program
+}
+
+// desNode - a node's place in its program & what's in flight to it
+type desNode struct {
+	id      int
+	clock   *SimClock
+	stats   CommStats
+	program []desStep // prologue, then one iteration
+	loop    int       // where the iteration starts in program
+	iter    int
+	step    int
+
+	next func() (op, bool) // rest of the current collective's schedule
+	stop func()
+
+	inbox   map[int][]float64 // arrival times of messages sent to me but not received, by sender
+	waitSrc int               // sender I'm blocked receiving from, -1 if none
+}
+
+// desQueue - nodes ready to do their next op, earliest simulated time first
+type desQueue []*desNode
+
+func (q desQueue) Len() int { return len(q) }
+func (q desQueue) Less(i, j int) bool {
+	if q[i].clock.Now != q[j].clock.Now {
+		return q[i].clock.Now < q[j].clock.Now
+	}
+	return q[i].id < q[j].id
+}
+func (q desQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *desQueue) Push(x any)   { *q = append(*q, x.(*desNode)) }
+func (q *desQueue) Pop() any {
+	old := *q
+	node := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return node
+}
+
+// runDES - simulate maxIter iterations on every node, returns the nodes when all are done
+func runDES(maxIter int) ([]*desNode, error) {
+	nodes := make([]*desNode, numNodes)
+	queue := make(desQueue, 0, numNodes)
+	for id := range nodes {
+		prologue, program := desProgram(id)
+		nodes[id] = &desNode{
+			id:      id,
+			clock:   newSimClock(),
+			program: append(prologue, program...),
+			loop:    len(prologue),
+			inbox:   make(map[int][]float64),
+			waitSrc: -1,
+		}
+		heap.Push(&queue, nodes[id])
+	}
+
+	for queue.Len() > 0 {
+		node := heap.Pop(&queue).(*desNode)
+		for _, ready := range node.advance(nodes, maxIter) {
+			heap.Push(&queue, ready)
+		}
+	}
+
+	for _, node := range nodes {
+		if node.iter < maxIter {
+			return nodes, fmt.Errorf("deadlock: node %d stuck in iteration %d, step %d, waiting on node %d",
+				node.id, node.iter, node.step, node.waitSrc)
+		}
+	}
+	return nodes, nil
+}
+
+// advance - do node's next op (or kernel), returns the nodes that can go on
+// afterwards: node itself unless it's blocked or done, & a receiver it unblocked
+func (node *desNode) advance(nodes []*desNode, maxIter int) []*desNode {
+	if node.iter == maxIter {
+		return nil
+	}
+	step := node.program[node.step]
+	node.clock.phase = step.phase
+
+	if step.ops == nil {
+		node.clock.Flops[step.phase] += step.flops
+		node.clock.advanceCompute(step.flops / flopRate)
+		node.nextStep()
+		return []*desNode{node}
+	}
+
+	if node.next == nil {
+		node.next, node.stop = iter.Pull(step.ops)
+	}
+	o, ok := node.next()
+	if !ok {
+		node.stop()
+		node.next, node.stop = nil, nil
+		node.nextStep()
+		return []*desNode{node}
+	}
+
+	peer := nodes[step.peer(o.peer)]
+	if !o.send {
+		queue := node.inbox[peer.id]
+		if len(queue) == 0 {
+			node.waitSrc = peer.id
+			return nil
+		}
+		node.inbox[peer.id] = queue[1:]
+		node.clock.waitUntil(queue[0])
+		return []*desNode{node}
+	}
+
+	// same accounting as Communicator.send
+	words := o.words()
+	node.stats.Messages++
+	node.stats.Words += words
+	bytes := 8 * words
+	node.clock.advanceComm(network.sendTime(bytes))
+	arrival := network.arrival(peer.id, node.clock.Now, bytes)
+
+	if peer.waitSrc == node.id {
+		peer.waitSrc = -1
+		peer.clock.waitUntil(arrival)
+		return []*desNode{node, peer}
+	}
+	peer.inbox[node.id] = append(peer.inbox[node.id], arrival)
+	return []*desNode{node}
+}
+
+func (node *desNode) nextStep() {
+	node.step++
+	if node.step == len(node.program) {
+		node.step = node.loop
+		node.iter++
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Hierarchical ALS (HALS)
+// Solves for one column of W (row of H) at a time, the others held fixed, & clips
+// at halsEps so nothing gets stuck at 0:
+//
+//	W(:,j) = max(eps, W(:,j) + (P(:,j) - W G(:,j)) / G(j,j)) 	G = H Ht, P = A Ht
+//	H(j,:) = max(eps, H(j,:) + (Q(j,:) - G(j,:) H) / G(j,j)) 	G = Wt W, Q = Wt A
+//
+// Each row of W (column of H) only needs its own row of P (column of Q), so every
+// node updates its Wij (Hji) alone. Unlike MPI-FAUN, W's columns aren't normalized
+// (that would need another all-reduce).
+const halsEps = 1e-16
+
+// Line 8 of MPI-FAUN - HALS
+// 		W dims = (m/p) x k
+// 		HGramMat dims = k x k
+// 		HProductMatij dims = (m/p) x k
+func halsUpdateW(W *mat.Dense, HGramMat *mat.Dense, HProductMatij mat.Matrix) {
+	rows, _ := W.Dims()
+	for j := 0; j < k; j++ {
+		gjj := HGramMat.At(j, j)
+		if gjj == 0 {
+			continue // column j of H is all 0, W(:,j) does nothing
+		}
+		g := HGramMat.RawRowView(j) // = column j, G is symmetric
+		for i := 0; i < rows; i++ {
+			w := W.RawRowView(i)
+			w[j] = max(halsEps, w[j]+(HProductMatij.At(i, j)-floats.Dot(w, g))/gjj)
+		}
+	}
+}
+
+// FLOPs of halsUpdateW on a W with rows rows: a dot product & 3 per element
+func halsUpdateWFlops(rows int) float64 {
+	return elemFlops(rows, k) * float64(2*k+3)
+}
+
+// Line 14 of MPI-FAUN - HALS
+// 		H dims = k x (n/p)
+// 		WGramMat dims = k x k
+// 		WProductMatji dims = k x (n/p)
+func halsUpdateH(H *mat.Dense, WGramMat *mat.Dense, WProductMatji mat.Matrix) {
+	_, cols := H.Dims()
+	gh := make([]float64, cols) // G(j,:) H
+	for j := 0; j < k; j++ {
+		gjj := WGramMat.At(j, j)
+		if gjj == 0 {
+			continue // column j of W is all 0, H(j,:) does nothing
+		}
+		for c := range gh {
+			gh[c] = 0
+		}
+		for l, g := range WGramMat.RawRowView(j) {
+			floats.AddScaled(gh, g, H.RawRowView(l))
+		}
+		h := H.RawRowView(j)
+		for c := range h {
+			h[c] = max(halsEps, h[c]+(WProductMatji.At(j, c)-gh[c])/gjj)
+		}
+	}
+}
+
+// FLOPs of halsUpdateH on an H with cols cols: G(j,:) H & 3 per element, per row
+func halsUpdateHFlops(cols int) float64 {
+	return elemFlops(k, cols) * float64(2*k+3)
+}
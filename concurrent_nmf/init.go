@@ -0,0 +1,160 @@
+package main
+
+import (
+	"569-final-project/nmfcore"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Initialization (-init), see nmfcore/init.go for the methods
+// One global W (m x k) & H (k x n) that every node only makes its own Wij & Hji of,
+// off the same pieces as the sequential programs - so the same blocks whatever the
+// grid, & the same W & H as theirs (up to rounding). Random numbers come from a
+// stream per row of W, column of H .. (see nmfcore.RNG), so a node only draws its
+// own. Init is setup like Split: what it sends isn't charged to the stats or the
+// simulated clocks (see handOff).
+
+// Init settings, set from the Config by applyConfig
+var initMethod = nmfcore.InitRandom
+var initWPath, initHPath string
+
+// initialFactors - node's blocks of the initial W & H (collective over the world, but for file)
+func (node *Node) initialFactors() (Wij, Hji mat.Dense) {
+	id := node.nodeID
+	if initMethod == nmfcore.InitFile {
+		var err error
+		if Wij, Hji, err = node.readFactors(); err != nil {
+			fatal(err)
+		}
+		return Wij, Hji
+	}
+
+	mean := node.meanA()
+	switch initMethod {
+	case nmfcore.InitNNDSVD, nmfcore.InitNNDSVDA, nmfcore.InitNNDSVDAR:
+		return node.nndsvd(mean)
+	case nmfcore.InitAcol:
+		Wij = *node.acolRows()
+		Hji.CloneFrom(nmfcore.UniformRows(node.seed, nmfcore.StreamH, hColStart[id], hCols[id], k, 2/float64(k)).T())
+		return Wij, Hji
+	}
+	scale := nmfcore.RandomScale(mean, k)
+	Wij = *nmfcore.UniformRows(node.seed, nmfcore.StreamW, wRowStart[id], wRows[id], k, scale)
+	Hji.CloneFrom(nmfcore.UniformRows(node.seed, nmfcore.StreamH, hColStart[id], hCols[id], k, scale).T())
+	return Wij, Hji
+}
+
+// meanA - mean of the entries of A (collective over the world)
+func (node *Node) meanA() float64 {
+	sum := mat.NewDense(1, 1, []float64{mat.Sum(node.aPiece)})
+	return node.world.allReduce(sum, allReduceAlgo).At(0, 0) / (float64(m) * float64(n))
+}
+
+// acolRows - node's Wij of random Acol (collective over the grid row)
+// Each node adds up the picked columns that are in its A_ij, the all-reduce across the
+// grid row adds those up into W_i.
+func (node *Node) acolRows() *mat.Dense {
+	id, row, col := node.nodeID, nodeRow(node.nodeID), nodeCol(node.nodeID)
+	aRows, aCols := node.aPiece.Dims()
+	part := mat.NewDense(aRows, k, nil)
+	for j := 0; j < k; j++ {
+		picks := nmfcore.AcolPicks(node.seed, j, n)
+		for _, c := range picks {
+			c -= aColOffsets[col]
+			if c < 0 || c >= aCols {
+				continue
+			}
+			for i := 0; i < aRows; i++ {
+				part.Set(i, j, part.At(i, j)+node.aPiece.At(i, c)/float64(len(picks)))
+			}
+		}
+	}
+	Wi := node.rowComm.allReduce(part, allReduceAlgo) // (m/p_r) x k
+	first := wRowStart[id] - aRowOffsets[row]
+	return mat.DenseCopyOf(Wi.Slice(first, first+wRows[id], 0, k))
+}
+
+// nndsvd - node's blocks of the NNDSVD init (collective over the world)
+// The randomized SVD works on the grid (see svdOps). nmfcore.NNDSVD needs the norms of
+// the parts over all of u_j & v_j: each U_i gets counted by the node in grid column 0,
+// each V_j by the node in grid row 0.
+func (node *Node) nndsvd(mean float64) (Wij, Hji mat.Dense) {
+	id, row, col := node.nodeID, nodeRow(node.nodeID), nodeCol(node.nodeID)
+	U, S, V, err := nmfcore.RandomizedSVD(node.svdOps(), m, n, k, node.seed) // U_i (m/p_r) x r, V_j (n/p_c) x r
+	if err != nil {
+		fatal(err)
+	}
+
+	r := len(S)
+	norms := mat.NewDense(4, r, nil) // |u+|^2, |u-|^2, |v+|^2, |v-|^2 by component
+	if col == 0 {
+		nmfcore.AddPartNorms(norms, 0, U)
+	}
+	if row == 0 {
+		nmfcore.AddPartNorms(norms, 2, V)
+	}
+	norms = node.world.allReduce(norms, allReduceAlgo)
+
+	wFirst, hFirst := wRowStart[id]-aRowOffsets[row], hColStart[id]-aColOffsets[col]
+	W, H := nmfcore.NNDSVD(U.Slice(wFirst, wFirst+wRows[id], 0, r), S, V.Slice(hFirst, hFirst+hCols[id], 0, r), norms, k)
+	nmfcore.FillZeros(initMethod, W, H, wRowStart[id], hColStart[id], mean, node.seed)
+	return *W, *H
+}
+
+// svdOps - A for nmfcore.RandomizedSVD on the grid, node's U_i ((m/p_r) x r) &
+// V_j ((n/p_c) x r) (collective over the world)
+// Products with A are every node's A_ij times its block & an all-reduce across its
+// grid row (or column). The small Gram matrices are all-reduced over the world, so
+// every node gets the same bits & the same eigenvectors.
+func (node *Node) svdOps() nmfcore.SVDOps {
+	row, col := nodeRow(node.nodeID), nodeCol(node.nodeID)
+	_, aCols := node.aPiece.Dims()
+	return nmfcore.SVDOps{
+		TimesA:   node.timesA,
+		TimesAt:  node.timesAt,
+		GramRows: func(Y *mat.Dense) *mat.Dense { return node.gram(Y, col == 0) }, // row block i, counted by grid column 0
+		GramCols: func(X *mat.Dense) *mat.Dense { return node.gram(X, row == 0) }, // column block j, counted by grid row 0
+		ColStart: aColOffsets[col],
+		Cols:     aCols,
+	}
+}
+
+// timesA - row block i of A X, from X's column block j (collective over the grid row)
+func (node *Node) timesA(Xj *mat.Dense) *mat.Dense {
+	part := &mat.Dense{}
+	part.Mul(node.aPiece, Xj)
+	return node.rowComm.allReduce(part, allReduceAlgo)
+}
+
+// timesAt - column block j of At Y, from Y's row block i (collective over the grid column)
+func (node *Node) timesAt(Yi *mat.Dense) *mat.Dense {
+	part := &mat.Dense{}
+	part.Mul(node.aPiece.T(), Yi)
+	return node.colComm.allReduce(part, allReduceAlgo)
+}
+
+// gram - Xt X of a matrix split into blocks, X's block counted by the nodes where counted
+// (collective over the world)
+func (node *Node) gram(X *mat.Dense, counted bool) *mat.Dense {
+	_, cols := X.Dims()
+	part := mat.NewDense(cols, cols, nil)
+	if counted {
+		part.Mul(X.T(), X)
+	}
+	return node.world.allReduce(part, allReduceAlgo)
+}
+
+// readFactors - node's blocks of the W & H in initWPath & initHPath, reading only
+// those (its rows of W, its columns of H)
+func (node *Node) readFactors() (Wij, Hji mat.Dense, err error) {
+	id := node.nodeID
+	W, err := nmfcore.ReadBlock(initWPath, m, k, wRowStart[id], wRows[id], 0, k)
+	if err != nil {
+		return Wij, Hji, err
+	}
+	H, err := nmfcore.ReadBlock(initHPath, k, n, 0, k, hColStart[id], hCols[id])
+	if err != nil {
+		return Wij, Hji, err
+	}
+	return *W, *H, nil
+}
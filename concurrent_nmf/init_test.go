@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"569-final-project/nmfcore"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// TestInitialFactors - on any grid the nodes' blocks put together are the W & H the
+// sequential programs start from (nmfcore.Initial), up to rounding
+func TestInitialFactors(t *testing.T) {
+	savedMethod, savedW, savedH := initMethod, initWPath, initHPath
+	defer func() { initMethod, initWPath, initHPath = savedMethod, savedW, savedH }()
+	k = 3
+	const rows, cols, seed = 13, 11, 5
+	A := nmfcore.UniformRows(99, 1, 0, rows, cols, 1)
+
+	dir := t.TempDir()
+	initWPath, initHPath = filepath.Join(dir, "W.txt"), filepath.Join(dir, "H.txt")
+	if err := nmfcore.WriteMatrix(initWPath, nmfcore.UniformRows(1, 1, 0, rows, k, 1), "test W"); err != nil {
+		t.Fatal(err)
+	}
+	if err := nmfcore.WriteMatrix(initHPath, nmfcore.UniformRows(1, 2, 0, k, cols, 1), "test H"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, method := range nmfcore.InitMethods {
+		W, H, err := nmfcore.Initial(A, k, method, seed, initWPath, initHPath)
+		if err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		initMethod = method
+		for _, grid := range [][2]int{{1, 1}, {2, 3}, {3, 2}, {1, 4}} {
+			setGrid(rows, cols, grid[0], grid[1])
+			name := fmt.Sprintf("%s on %d x %d", method, grid[0], grid[1])
+			var wrong atomic.Int32
+			onEach(numNodes, func(c *Communicator) {
+				id := c.Rank()
+				row, col := nodeRow(id), nodeCol(id)
+				aPiece := A.Slice(aRowOffsets[row], aRowOffsets[row+1], aColOffsets[col], aColOffsets[col+1])
+				node := makeNode(c, nil, aPiece, seed)
+				node.splitGrid()
+				Wij, Hji := node.initialFactors()
+				wantW := W.Slice(wRowStart[id], wRowStart[id]+wRows[id], 0, k)
+				wantH := H.Slice(0, k, hColStart[id], hColStart[id]+hCols[id])
+				if !mat.EqualApprox(&Wij, wantW, 1e-9) || !mat.EqualApprox(&Hji, wantH, 1e-9) {
+					wrong.Add(1)
+				}
+			})
+			if n := wrong.Load(); n > 0 {
+				t.Errorf("%s: %d nodes' blocks aren't nmfcore.Initial's", name, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,546 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Input files (-data file -input path)
+// A comes from a file, its format by the extension:
+//	.mtx 		- Matrix Market, coordinate (sparse) or array (dense); real, integer or
+//				  pattern; general or symmetric
+//	.csv .tsv 	- a row a line, split by commas (tabs). Lines starting with # are
+//				  skipped, & so is a first line that isn't numbers (a header)
+//	.npy 		- NumPy, 2-D, float or int of any size & byte order, C or Fortran order
+// m & n come from the file (see Config.inputDims), which counts the rows of a .csv or
+// .tsv once, for the whole run; the nodes get them (& whether there's a header) from
+// the Config. A node reads only its own block (see makeAPiece), scanning the text
+// formats & keeping what falls inside it, or seeking to its rows (or columns) of a
+// .npy, so all of A is never in one place. Sparse files come out as dense blocks, the
+// nodes only do dense math.
+var inputPath string
+var inputHeader bool // the .csv/.tsv has a header line
+
+// aReader - a file of A, read a block at a time
+type aReader interface {
+	Dims() (rows, cols int)
+	// Block - the rows x cols block at (rowStart, colStart)
+	Block(rowStart, rows, colStart, cols int) (*mat.Dense, error)
+}
+
+var inputExts = []string{".mtx", ".csv", ".tsv", ".npy"}
+
+// openInput - a reader of path, by its extension
+func openInput(path string) (aReader, error) {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".mtx":
+		return openMatrixMarket(path)
+	case ".csv":
+		return openDelimited(path, ',')
+	case ".tsv":
+		return openDelimited(path, '\t')
+	case ".npy":
+		return openNpy(path)
+	default:
+		return nil, fmt.Errorf("%s: unknown input format %q (want one of %v)", path, ext, inputExts)
+	}
+}
+
+// readBlock - the block of A at (rowStart, colStart) from -input
+// A .csv or .tsv isn't read through again, it's m x n with inputHeader.
+func readBlock(rowStart, rows, colStart, cols int) (*mat.Dense, error) {
+	var r aReader
+	var err error
+	switch strings.ToLower(filepath.Ext(inputPath)) {
+	case ".csv":
+		r = &delimited{path: inputPath, comma: ',', rows: m, cols: n, header: inputHeader}
+	case ".tsv":
+		r = &delimited{path: inputPath, comma: '\t', rows: m, cols: n, header: inputHeader}
+	default:
+		if r, err = openInput(inputPath); err != nil {
+			return nil, err
+		}
+	}
+	if rs, cs := r.Dims(); rs != m || cs != n {
+		return nil, fmt.Errorf("%s is %d x %d, not m x n = %d x %d", inputPath, rs, cs, m, n)
+	}
+	return r.Block(rowStart, rows, colStart, cols)
+}
+
+// inBlock - where global (i, j) lands in a block, ok = false outside it
+func inBlock(i, j, rowStart, rows, colStart, cols int) (int, int, bool) {
+	i, j = i-rowStart, j-colStart
+	return i, j, i >= 0 && i < rows && j >= 0 && j < cols
+}
+
+// checkEntry - A has to be nonnegative (& a number)
+func checkEntry(path string, line int, x float64) error {
+	if !(x >= 0) || math.IsInf(x, 0) {
+		return fmt.Errorf("%s:%d: %g, A has to be nonnegative", path, line, x)
+	}
+	return nil
+}
+
+// Matrix Market
+
+type matrixMarket struct {
+	path             string
+	rows, cols, nnz  int
+	coordinate       bool
+	pattern          bool // coordinate without values, all 1
+	symmetric        bool // only the lower triangle is stored
+	dataLine, header int  // first line after the size line, its byte offset
+}
+
+func openMatrixMarket(path string) (*matrixMarket, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mm := &matrixMarket{path: path}
+	br := bufio.NewReader(f)
+	banner, err := br.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	fields := strings.Fields(strings.ToLower(banner))
+	if len(fields) != 5 || fields[0] != "%%matrixmarket" || fields[1] != "matrix" {
+		return nil, fmt.Errorf("%s:1: not a Matrix Market matrix header", path)
+	}
+	switch fields[2] {
+	case "coordinate":
+		mm.coordinate = true
+	case "array":
+	default:
+		return nil, fmt.Errorf("%s:1: unknown format %q, want coordinate or array", path, fields[2])
+	}
+	switch fields[3] {
+	case "real", "integer", "double":
+	case "pattern":
+		if !mm.coordinate {
+			return nil, fmt.Errorf("%s:1: pattern needs the coordinate format", path)
+		}
+		mm.pattern = true
+	default:
+		return nil, fmt.Errorf("%s:1: %s entries, A has to be real", path, fields[3])
+	}
+	switch fields[4] {
+	case "general":
+	case "symmetric":
+		mm.symmetric = true
+	default:
+		return nil, fmt.Errorf("%s:1: %s matrices aren't nonnegative, want general or symmetric", path, fields[4])
+	}
+
+	// comments, then the size line
+	offset, line := len(banner), 1
+	for {
+		text, err := br.ReadString('\n')
+		offset += len(text)
+		line++
+		if text == "" && err != nil {
+			return nil, fmt.Errorf("%s: no size line", path)
+		}
+		text = strings.TrimSpace(text)
+		if text == "" || text[0] == '%' {
+			continue
+		}
+		size := strings.Fields(text)
+		want := 2
+		if mm.coordinate {
+			want = 3
+		}
+		nums := make([]int, len(size))
+		for i, s := range size {
+			if nums[i], err = strconv.Atoi(s); err != nil || nums[i] < 0 {
+				nums = nil
+				break
+			}
+		}
+		if len(nums) != want {
+			return nil, fmt.Errorf("%s:%d: want a size line of %d counts", path, line, want)
+		}
+		mm.rows, mm.cols = nums[0], nums[1]
+		if mm.coordinate {
+			mm.nnz = nums[2]
+		}
+		if mm.symmetric && mm.rows != mm.cols {
+			return nil, fmt.Errorf("%s:%d: symmetric but %d x %d", path, line, mm.rows, mm.cols)
+		}
+		mm.dataLine, mm.header = line+1, offset
+		return mm, nil
+	}
+}
+
+func (mm *matrixMarket) Dims() (int, int) { return mm.rows, mm.cols }
+
+// Block - read all the entries, keep the block's
+func (mm *matrixMarket) Block(rowStart, rows, colStart, cols int) (*mat.Dense, error) {
+	f, err := os.Open(mm.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(int64(mm.header), io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	X := mat.NewDense(rows, cols, nil)
+	put := func(i, j int, x float64) {
+		if bi, bj, ok := inBlock(i, j, rowStart, rows, colStart, cols); ok {
+			X.Set(bi, bj, X.At(bi, bj)+x) // duplicate entries add up
+		}
+		if mm.symmetric && i != j {
+			if bi, bj, ok := inBlock(j, i, rowStart, rows, colStart, cols); ok {
+				X.Set(bi, bj, X.At(bi, bj)+x)
+			}
+		}
+	}
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), math.MaxInt32)
+	want := mm.rows * mm.cols // array: column by column
+	if mm.symmetric {
+		want = mm.rows * (mm.rows + 1) / 2 // lower triangle
+	}
+	if mm.coordinate {
+		want = mm.nnz
+	}
+	i, j, got := 0, 0, 0
+	for line := mm.dataLine; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '%' {
+			continue
+		}
+		if got == want {
+			return nil, fmt.Errorf("%s:%d: more than the %d entries of the size line", mm.path, line, want)
+		}
+		fields := strings.Fields(text)
+		x := 1.0
+		if mm.coordinate {
+			wantFields := 3
+			if mm.pattern {
+				wantFields = 2
+			}
+			if len(fields) != wantFields {
+				return nil, fmt.Errorf("%s:%d: want %d fields, got %d", mm.path, line, wantFields, len(fields))
+			}
+			i, err = strconv.Atoi(fields[0])
+			if err == nil {
+				j, err = strconv.Atoi(fields[1])
+			}
+			if err != nil || i < 1 || i > mm.rows || j < 1 || j > mm.cols {
+				return nil, fmt.Errorf("%s:%d: entry (%s, %s) outside the %d x %d matrix", mm.path, line, fields[0], fields[1], mm.rows, mm.cols)
+			}
+			i, j = i-1, j-1
+			fields = fields[2:]
+		} else if len(fields) != 1 {
+			return nil, fmt.Errorf("%s:%d: want 1 value, got %d", mm.path, line, len(fields))
+		}
+		if len(fields) == 1 {
+			if x, err = strconv.ParseFloat(fields[0], 64); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", mm.path, line, err)
+			}
+		}
+		if err := checkEntry(mm.path, line, x); err != nil {
+			return nil, err
+		}
+		if mm.symmetric && i < j {
+			return nil, fmt.Errorf("%s:%d: symmetric but (%d, %d) is above the diagonal", mm.path, line, i+1, j+1)
+		}
+		put(i, j, x)
+		got++
+
+		if !mm.coordinate {
+			// next array entry, down the column (from the diagonal if symmetric)
+			if i++; i == mm.rows {
+				j++
+				i = 0
+				if mm.symmetric {
+					i = j
+				}
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", mm.path, err)
+	}
+	if got != want {
+		return nil, fmt.Errorf("%s: %d entries, the size line says %d", mm.path, got, want)
+	}
+	return X, nil
+}
+
+// CSV & TSV
+
+type delimited struct {
+	path       string
+	comma      rune
+	rows, cols int
+	header     bool // the first record is a header
+}
+
+func (d *delimited) reader(f *os.File) *csv.Reader {
+	r := csv.NewReader(bufio.NewReader(f))
+	r.Comma = d.comma
+	r.Comment = '#'
+	r.ReuseRecord = true
+	r.TrimLeadingSpace = true
+	return r
+}
+
+// openDelimited - count the rows (a pass over the file) & the columns
+func openDelimited(path string, comma rune) (*delimited, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := &delimited{path: path, comma: comma}
+	r := d.reader(f)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		if d.rows == 0 && !d.header {
+			if _, err := strconv.ParseFloat(strings.TrimSpace(record[0]), 64); err != nil {
+				d.header = true
+				continue
+			}
+		}
+		d.rows++
+		d.cols = len(record)
+	}
+	if d.rows == 0 {
+		return nil, fmt.Errorf("%s: no rows", path)
+	}
+	return d, nil
+}
+
+func (d *delimited) Dims() (int, int) { return d.rows, d.cols }
+
+// Block - read the rows up to the block's last, keep the block's columns of its rows
+func (d *delimited) Block(rowStart, rows, colStart, cols int) (*mat.Dense, error) {
+	f, err := os.Open(d.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	X := mat.NewDense(rows, cols, nil)
+	r := d.reader(f)
+	if d.header {
+		if _, err := r.Read(); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", d.path, err)
+		}
+	}
+	for i := 0; i < rowStart+rows; i++ {
+		record, err := r.Read()
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", d.path, err)
+		}
+		line, _ := r.FieldPos(0)
+		if len(record) != d.cols {
+			return nil, fmt.Errorf("%s:%d: %d fields, want %d", d.path, line, len(record), d.cols)
+		}
+		if i < rowStart {
+			continue
+		}
+		for j := 0; j < cols; j++ {
+			x, err := strconv.ParseFloat(strings.TrimSpace(record[colStart+j]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", d.path, line, err)
+			}
+			if err := checkEntry(d.path, line, x); err != nil {
+				return nil, err
+			}
+			X.Set(i-rowStart, j, x)
+		}
+	}
+	return X, nil
+}
+
+// NumPy .npy (format versions 1 to 3)
+
+type npy struct {
+	path       string
+	rows, cols int
+	fortran    bool // column-major
+	order      binary.ByteOrder
+	size       int // bytes per entry
+	decode     func([]byte) float64
+	offset     int64 // of the data
+}
+
+func openNpy(path string) (*npy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var preamble [10]byte
+	if _, err := io.ReadFull(f, preamble[:8]); err != nil || string(preamble[:6]) != "\x93NUMPY" {
+		return nil, fmt.Errorf("%s: not a .npy file", path)
+	}
+	var headerLen int
+	switch preamble[6] {
+	case 1:
+		if _, err := io.ReadFull(f, preamble[8:10]); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		headerLen = int(binary.LittleEndian.Uint16(preamble[8:10]))
+	case 2, 3:
+		var n [4]byte
+		if _, err := io.ReadFull(f, n[:]); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+		headerLen = int(binary.LittleEndian.Uint32(n[:]))
+	default:
+		return nil, fmt.Errorf("%s: .npy version %d.%d", path, preamble[6], preamble[7])
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	offset, _ := f.Seek(0, io.SeekCurrent)
+
+	// the header is a Python dict literal: {'descr': '<f8', 'fortran_order': False, 'shape': (3, 4), }
+	dict := string(header)
+	value := func(key string) string {
+		_, rest, ok := strings.Cut(dict, "'"+key+"':")
+		if !ok {
+			return ""
+		}
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, "(") {
+			shape, _, _ := strings.Cut(rest[1:], ")")
+			return shape
+		}
+		v, _, _ := strings.Cut(rest, ",")
+		return strings.Trim(strings.TrimSpace(v), "'\"")
+	}
+	a := &npy{path: path, offset: offset, fortran: value("fortran_order") == "True"}
+	var dims []int
+	for _, s := range strings.Split(value("shape"), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		d, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: bad shape (%s)", path, value("shape"))
+		}
+		dims = append(dims, d)
+	}
+	if len(dims) != 2 {
+		return nil, fmt.Errorf("%s: shape (%s), want a 2-D array", path, value("shape"))
+	}
+	a.rows, a.cols = dims[0], dims[1]
+	if err := a.setType(value("descr")); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if info, err := f.Stat(); err != nil || info.Size() < offset+int64(a.rows*a.cols*a.size) {
+		return nil, fmt.Errorf("%s: shorter than its %d x %d %s entries", path, a.rows, a.cols, value("descr"))
+	}
+	return a, nil
+}
+
+// setType - byte order, size & decoding of a dtype like <f8
+func (a *npy) setType(descr string) error {
+	if len(descr) < 3 {
+		return fmt.Errorf("unknown dtype %q", descr)
+	}
+	a.order = binary.ByteOrder(binary.LittleEndian)
+	if descr[0] == '>' {
+		a.order = binary.BigEndian
+	}
+	size, err := strconv.Atoi(descr[2:])
+	if err != nil {
+		return fmt.Errorf("unknown dtype %q", descr)
+	}
+	a.size = size
+	order := a.order
+	switch descr[1:] {
+	case "f8":
+		a.decode = func(b []byte) float64 { return math.Float64frombits(order.Uint64(b)) }
+	case "f4":
+		a.decode = func(b []byte) float64 { return float64(math.Float32frombits(order.Uint32(b))) }
+	case "i8":
+		a.decode = func(b []byte) float64 { return float64(int64(order.Uint64(b))) }
+	case "i4":
+		a.decode = func(b []byte) float64 { return float64(int32(order.Uint32(b))) }
+	case "i2":
+		a.decode = func(b []byte) float64 { return float64(int16(order.Uint16(b))) }
+	case "i1":
+		a.decode = func(b []byte) float64 { return float64(int8(b[0])) }
+	case "u8":
+		a.decode = func(b []byte) float64 { return float64(order.Uint64(b)) }
+	case "u4":
+		a.decode = func(b []byte) float64 { return float64(order.Uint32(b)) }
+	case "u2":
+		a.decode = func(b []byte) float64 { return float64(order.Uint16(b)) }
+	case "u1", "b1":
+		a.decode = func(b []byte) float64 { return float64(b[0]) }
+	default:
+		return fmt.Errorf("dtype %q, want a float, int or uint", descr)
+	}
+	return nil
+}
+
+func (a *npy) Dims() (int, int) { return a.rows, a.cols }
+
+// Block - a read per row (column, if Fortran order) of the block
+func (a *npy) Block(rowStart, rows, colStart, cols int) (*mat.Dense, error) {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// C order: lines are rows, Fortran order: lines are columns
+	lines, lineStart, length, start, lineLen := rows, rowStart, cols, colStart, a.cols
+	if a.fortran {
+		lines, lineStart, length, start, lineLen = cols, colStart, rows, rowStart, a.rows
+	}
+	X := mat.NewDense(rows, cols, nil)
+	buf := make([]byte, length*a.size)
+	for l := 0; l < lines; l++ {
+		at := a.offset + int64(((lineStart+l)*lineLen+start)*a.size)
+		if _, err := f.ReadAt(buf, at); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("reading %s: %w", a.path, err)
+		}
+		for e := 0; e < length; e++ {
+			x := a.decode(buf[e*a.size:])
+			if !(x >= 0) || math.IsInf(x, 0) {
+				return nil, fmt.Errorf("%s: %g, A has to be nonnegative", a.path, x)
+			}
+			if a.fortran {
+				X.Set(e, l, x)
+			} else {
+				X.Set(l, e, x)
+			}
+		}
+	}
+	return X, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// npyFile - a version 1.0 .npy of the rows x cols values (C order, or Fortran order
+// if fortran), each put by put in size bytes
+func npyFile(descr string, fortran bool, rows, cols, size int, values []float64, put func([]byte, float64)) []byte {
+	order := "False"
+	if fortran {
+		order = "True"
+	}
+	header := fmt.Sprintf("{'descr': '%s', 'fortran_order': %s, 'shape': (%d, %d), }", descr, order, rows, cols)
+	header += strings.Repeat(" ", 63-(10+len(header))%64) + "\n" // data starts 64-byte aligned
+	var b bytes.Buffer
+	b.WriteString("\x93NUMPY\x01\x00")
+	binary.Write(&b, binary.LittleEndian, uint16(len(header)))
+	b.WriteString(header)
+	entry := make([]byte, size)
+	for l := 0; l < rows*cols; l++ {
+		i, j := l/cols, l%cols
+		if fortran {
+			i, j = l%rows, l/rows
+		}
+		put(entry, values[i*cols+j])
+		b.Write(entry)
+	}
+	return b.Bytes()
+}
+
+// TestInputFormats - every format reads as the matrix it holds, whole & by blocks
+func TestInputFormats(t *testing.T) {
+	// 3 x 4, & 3 x 3 symmetric
+	general := []float64{
+		1, 0, 2.5, 0,
+		0, 3, 0, 4,
+		5, 0, 0, 6,
+	}
+	symmetric := []float64{
+		1, 2, 0,
+		2, 0, 3,
+		0, 3, 4,
+	}
+	pattern := []float64{
+		1, 0, 0, 1,
+		0, 1, 0, 0,
+		2, 0, 0, 1, // (3, 1) is listed twice, duplicates add up
+	}
+	f8 := func(order binary.ByteOrder) func([]byte, float64) {
+		return func(b []byte, x float64) { order.PutUint64(b, math.Float64bits(x)) }
+	}
+
+	cases := []struct {
+		name, file string
+		data       []byte
+		rows, cols int
+		want       []float64
+		header     bool
+	}{
+		{"mtx coordinate general", "a.mtx", []byte("%%MatrixMarket matrix coordinate real general\n% comment\n3 4 6\n1 1 1\n1 3 2.5\n2 2 3\n2 4 4\n3 1 5\n3 4 6\n"), 3, 4, general, false},
+		{"mtx coordinate symmetric", "a.mtx", []byte("%%MatrixMarket matrix coordinate real symmetric\n3 3 4\n1 1 1\n2 1 2\n3 2 3\n3 3 4\n"), 3, 3, symmetric, false},
+		{"mtx array symmetric", "a.mtx", []byte("%%MatrixMarket matrix array integer symmetric\n3 3\n1\n2\n0\n0\n3\n4\n"), 3, 3, symmetric, false},
+		{"mtx pattern", "a.mtx", []byte("%%MatrixMarket matrix coordinate pattern general\n3 4 6\n1 1\n1 4\n2 2\n3 1\n3 4\n3 1\n"), 3, 4, pattern, false},
+		{"csv with header", "a.csv", []byte("a,b,c,d\n1,0,2.5,0\n# comment\n0,3,0,4\n5,0,0,6\n"), 3, 4, general, true},
+		{"csv without header", "a.csv", []byte("1, 0, 2.5, 0\n0, 3, 0, 4\n5, 0, 0, 6\n"), 3, 4, general, false},
+		{"tsv with header", "a.tsv", []byte("a\tb\tc\td\n1\t0\t2.5\t0\n0\t3\t0\t4\n5\t0\t0\t6\n"), 3, 4, general, true},
+		{"npy little-endian C order", "a.npy", npyFile("<f8", false, 3, 4, 8, general, f8(binary.LittleEndian)), 3, 4, general, false},
+		{"npy big-endian C order", "a.npy", npyFile(">f8", false, 3, 4, 8, general, f8(binary.BigEndian)), 3, 4, general, false},
+		{"npy little-endian Fortran order", "a.npy", npyFile("<f8", true, 3, 4, 8, general, f8(binary.LittleEndian)), 3, 4, general, false},
+		{"npy big-endian Fortran order", "a.npy", npyFile(">f8", true, 3, 4, 8, general, f8(binary.BigEndian)), 3, 4, general, false},
+		{"npy big-endian int32", "a.npy", npyFile(">i4", true, 3, 3, 4, symmetric, func(b []byte, x float64) { binary.BigEndian.PutUint32(b, uint32(int32(x))) }), 3, 3, symmetric, false},
+	}
+	for _, tc := range cases {
+		path := filepath.Join(t.TempDir(), tc.file)
+		if err := os.WriteFile(path, tc.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := openInput(path)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if rows, cols := r.Dims(); rows != tc.rows || cols != tc.cols {
+			t.Errorf("%s: %d x %d, want %d x %d", tc.name, rows, cols, tc.rows, tc.cols)
+			continue
+		}
+		if d, ok := r.(*delimited); ok && d.header != tc.header {
+			t.Errorf("%s: header %t, want %t", tc.name, d.header, tc.header)
+		}
+
+		// every block, read the way the nodes do (see readBlock)
+		want := mat.NewDense(tc.rows, tc.cols, tc.want)
+		m, n, inputPath, inputHeader = tc.rows, tc.cols, path, tc.header
+		for rowStart := 0; rowStart < tc.rows; rowStart++ {
+			for colStart := 0; colStart < tc.cols; colStart++ {
+				rows, cols := tc.rows-rowStart, tc.cols-colStart
+				for _, size := range [][2]int{{1, 1}, {rows, cols}, {(rows + 1) / 2, cols}} {
+					X, err := readBlock(rowStart, size[0], colStart, size[1])
+					if err != nil {
+						t.Fatalf("%s: block at (%d, %d): %v", tc.name, rowStart, colStart, err)
+					}
+					if !mat.Equal(X, want.Slice(rowStart, rowStart+size[0], colStart, colStart+size[1])) {
+						t.Fatalf("%s: block %v at (%d, %d) is\n%v", tc.name, size, rowStart, colStart, mat.Formatted(X))
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestInputRejects - files that aren't a nonnegative matrix are errors, not panics
+func TestInputRejects(t *testing.T) {
+	cases := []struct {
+		name, file, data string
+	}{
+		{"mtx negative", "a.mtx", "%%MatrixMarket matrix coordinate real general\n2 2 1\n1 1 -1\n"},
+		{"mtx outside", "a.mtx", "%%MatrixMarket matrix coordinate real general\n2 2 1\n3 1 1\n"},
+		{"mtx too few", "a.mtx", "%%MatrixMarket matrix array real general\n2 2\n1\n2\n3\n"},
+		{"mtx symmetric upper", "a.mtx", "%%MatrixMarket matrix coordinate real symmetric\n2 2 1\n1 2 1\n"},
+		{"mtx complex", "a.mtx", "%%MatrixMarket matrix coordinate complex general\n2 2 0\n"},
+		{"csv ragged", "a.csv", "1,2\n3\n"},
+		{"csv not a number", "a.csv", "a,b\n1,x\n"},
+		{"csv negative", "a.csv", "1,2\n3,-4\n"},
+	}
+	for _, tc := range cases {
+		path := filepath.Join(t.TempDir(), tc.file)
+		if err := os.WriteFile(path, []byte(tc.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := openInput(path)
+		if err == nil {
+			rows, cols := r.Dims()
+			_, err = r.Block(0, rows, 0, cols)
+		}
+		if err == nil {
+			t.Errorf("%s: read without an error", tc.name)
+		}
+	}
+}
+
+// TestInputDims - m & n come from the file, & an m or n given that isn't the file's
+// is an error, on the command line or in a config file
+func TestInputDims(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.csv")
+	if err := os.WriteFile(path, []byte("x,y,z\n1,2,3\n4,5,6\n7,8,9\n10,11,12\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(dir, "run.json")
+	if err := os.WriteFile(config, []byte(`{"m": 5}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	base := []string{"-data", "file", "-input", path, "-k", "2", "-p", "1"}
+
+	cfg, err := parseConfig(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.M != 4 || cfg.N != 3 || !cfg.InputHeader {
+		t.Errorf("m x n = %d x %d, header %t, want 4 x 3 with a header", cfg.M, cfg.N, cfg.InputHeader)
+	}
+	if _, err := parseConfig(append(base, "-m", "4", "-n", "3")); err != nil {
+		t.Errorf("the file's m & n: %v", err)
+	}
+	for _, args := range [][]string{{"-m", "5"}, {"-n", "2048"}, {"-config", config}} {
+		if _, err := parseConfig(append(base, args...)); err == nil {
+			t.Errorf("%v: no error for an m x n that isn't the file's", args)
+		}
+	}
+	if _, err := parseConfig(append(base, "-config", config, "-m", "4")); err != nil {
+		t.Errorf("-m 4 over the config file's m: %v", err)
+	}
+
+	// node processes take m, n & the header from the launcher without opening the file
+	cfg, err = parseConfig([]string{"-data", "file", "-input", filepath.Join(dir, "missing.csv"), "-k", "2", "-p", "1",
+		"-transport", "tcp", "-rank", "0", "-m", "4", "-n", "3", "-inputheader"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.M != 4 || cfg.N != 3 || !cfg.InputHeader {
+		t.Errorf("node process: m x n = %d x %d, header %t, want the launcher's", cfg.M, cfg.N, cfg.InputHeader)
+	}
+}
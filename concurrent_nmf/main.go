@@ -1,9 +1,9 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"math"
-	"math/rand"
+	"os"
 	"sync"
 	"time"
 
@@ -22,60 +22,113 @@ func matPrint(X mat.Matrix) {
 
 // Corresponding MPI-FAUN steps in comments
 func parallelNMF(node *Node, maxIter int) {
-	// Local matrices
-	var Wij, Hji mat.Dense
+	// Row & column communicators for the grid
+	node.splitGrid()
 
+	// Local matrices
 	// 1) Initialize Hji - dims = k x (n/p)
-	h := make([]float64, k*smallBlockSizeH)
-	for i := range h {
-		h[i] = rand.NormFloat64()
+	Wij, Hji, done := node.initFactors()
+	smallBlockSizeW, smallBlockSizeH := wRows[node.nodeID], hCols[node.nodeID]
+	aRows, aCols := node.aPiece.Dims()
+	if reporting {
+		node.report(&Wij, &Hji, done)
 	}
-	Hji = *mat.NewDense(k, smallBlockSizeH, h)
-	// Not in paper, but initialize Wij too - dims = (m/p) x k
-	w := make([]float64, smallBlockSizeW*k)
-	for i := range w {
-		w[i] = rand.NormFloat64()
-	}
-	Wij = *mat.NewDense(smallBlockSizeW, k, w)
 
+	// Products, from the buffer pool - Mul reuses their storage every iteration
+	// In share mode the naive collectives send them (& Wij, Hji) as they are, but no
+	// other node reads them once the collective returns (see recycle).
+	Uij, Vij := pooledDense(k, k), pooledDense(aRows, k)
+	Xij, Yij := pooledDense(k, k), pooledDense(k, aCols)
+
+	var cv *convergence
+	if trackError {
+		cv = node.newConvergence()
+	}
+	iters := maxIter
 	for iter := 0; iter < maxIter; iter++ {
+		node.setEpoch(iter)
 		// Update W Part
 		// 3)
-		Uij := &mat.Dense{}
-		Uij.Mul(&Hji, Hji.T()) // k x k
+		node.compute(phaseGram, mulFlops(k, smallBlockSizeH, k), func() { Uij.Mul(&Hji, Hji.T()) }) // k x k
 		// 4)
 		HGramMat := node.allReduce(Uij)
 		// 5)
 		Hj := node.allGatherAcrossNodeColumns(&Hji) // k x (n/p_c)
 		// 6)
-		Vij := &mat.Dense{}
-		Vij.Mul(node.aPiece, Hj.T()) // (m/pr) x k
+		node.compute(phaseMM, mulFlops(aRows, aCols, k), func() { Vij.Mul(node.aPiece, Hj.T()) }) // (m/pr) x k
 		// 7)
 		HProductMatij := node.reduceScatterAcrossNodeRows(Vij) // (m/p) x k
 		// 8)
-		updateW(&Wij, HGramMat, HProductMatij)
+		node.compute(phaseNLS, updateWFlops(smallBlockSizeW), func() { updateW(&Wij, HGramMat, HProductMatij) })
 		// Update H Part
 		// 9)
-		Xij := &mat.Dense{}
-		Xij.Mul(Wij.T(), &Wij) // k x k
+		node.compute(phaseGram, mulFlops(k, smallBlockSizeW, k), func() { Xij.Mul(Wij.T(), &Wij) }) // k x k
 		// 10)
 		WGramMat := node.allReduce(Xij)
 		// 11)
 		Wi := node.allGatherAcrossNodeRows(&Wij) // (m/p_r) x k
 		// 12)
-		Yij := &mat.Dense{}
-		Yij.Mul(Wi.T(), node.aPiece) // k x (n/p_c)
+		node.compute(phaseMM, mulFlops(k, aRows, aCols), func() { Yij.Mul(Wi.T(), node.aPiece) }) // k x (n/p_c)
 		// 13)
 		WProductMatji := node.reduceScatterAcrossNodeColumns(Yij) // k x (n/p)
 		// 14)
-		updateH(&Hji, WGramMat, WProductMatji)
+		node.compute(phaseNLS, updateHFlops(smallBlockSizeH), func() { updateH(&Hji, WGramMat, WProductMatji) })
+		if reporting {
+			node.report(&Wij, &Hji, done+iter+1)
+		}
+		// Objective & stopping criteria (see convergence.go)
+		if cv == nil {
+			continue
+		}
+		if reason := node.checkConvergence(cv, iter, WGramMat, WProductMatji, &Hji); reason != "" {
+			if node.nodeID == 0 {
+				fmt.Printf("Stopped after %d iterations: %s\n", iter+1, reason)
+			}
+			iters = iter + 1
+			break
+		}
+	}
+	node.world.clock.Iters = iters
+	release(Uij, Vij, Xij, Yij)
+	node.finish(&Wij, &Hji, done+iters)
+
+	wg.Done()
+}
+
+// initFactors - node's Wij & Hji, from the checkpoint in resumeDir or the -init method
+// (see init.go), & how many iterations they've had in earlier runs
+func (node *Node) initFactors() (Wij, Hji mat.Dense, done int) {
+	if resumeDir != "" {
+		var err error
+		if Wij, Hji, done, err = node.loadCheckpoint(resumeDir); err != nil {
+			fatal(err)
+		}
+		return Wij, Hji, done
+	}
+	// setup, not charged (see handOff)
+	node.world.clock.setup = true
+	Wij, Hji = node.initialFactors()
+	node.world.clock.setup = false
+	return Wij, Hji, 0
+}
+
+// finish - checkpoint Wij & Hji (after iters iterations in all) if asked to, & send them to the client
+func (node *Node) finish(Wij, Hji *mat.Dense, iters int) {
+	if checkpointDir != "" {
+		if err := node.saveCheckpoint(checkpointDir, Wij, Hji, iters); err != nil {
+			fatal(err)
+		}
 	}
 
 	// Send Wij & Hji to client
-	node.clientChan <- MatMessage{Wij, node.nodeID, true, false}
-	node.clientChan <- MatMessage{Hji, node.nodeID, false, true}
+	node.clientChan <- MatMessage{mtx: *Wij, sentID: node.nodeID, epoch: iters, isFinalW: true, arrival: node.world.clock.Now}
+	node.clientChan <- MatMessage{mtx: *Hji, sentID: node.nodeID, epoch: iters, isFinalH: true, arrival: node.world.clock.Now}
+}
 
-	wg.Done()
+// report - send copies of Wij & Hji, after iters iterations in all, to the client (see crosscheck.go)
+func (node *Node) report(Wij, Hji *mat.Dense, iters int) {
+	node.clientChan <- MatMessage{mtx: *mat.DenseCopyOf(Wij), sentID: node.nodeID, epoch: iters, isFinalW: true}
+	node.clientChan <- MatMessage{mtx: *mat.DenseCopyOf(Hji), sentID: node.nodeID, epoch: iters, isFinalH: true}
 }
 
 // Line 8 of MPI-FAUN - Multiplicative Update: W = W * ((A @ Ht) / (W @ (H @ Ht)))
@@ -83,7 +136,7 @@ func parallelNMF(node *Node, maxIter int) {
 // 		W dims = (m/p) x k
 // 		HGramMat dims = k x k
 // 		HProductMatij dims = (m/p) x k
-func updateW(W *mat.Dense, HGramMat *mat.Dense, HProductMatij mat.Matrix) {
+func muUpdateW(W *mat.Dense, HGramMat *mat.Dense, HProductMatij mat.Matrix) {
 	update := &mat.Dense{}
 	update.Mul(W, HGramMat) // (m/p) x k
 
@@ -91,12 +144,17 @@ func updateW(W *mat.Dense, HGramMat *mat.Dense, HProductMatij mat.Matrix) {
 	W.MulElem(W, update)
 }
 
+// FLOPs of muUpdateW on a W with rows rows: Mul, DivElem & MulElem
+func muUpdateWFlops(rows int) float64 {
+	return mulFlops(rows, k, k) + 2*elemFlops(rows, k)
+}
+
 // Line 14 of MPI-FAUN - Multiplicative Update: H = H * ((Wt @ A) / ((Wt @ W) @ H))
 // Formula uses: Gram matrix, matrix product w/ A, and H
 // 		H dims = k x (n/p)
 // 		WGramMat dims = k x k
 // 		WProductMatji dims = k x (n/p)
-func updateH(H *mat.Dense, WGramMat *mat.Dense, WProductMatji mat.Matrix) {
+func muUpdateH(H *mat.Dense, WGramMat *mat.Dense, WProductMatji mat.Matrix) {
 	update := &mat.Dense{}
 	update.Mul(WGramMat, H) // k x (n/p)
 
@@ -104,12 +162,60 @@ func updateH(H *mat.Dense, WGramMat *mat.Dense, WProductMatji mat.Matrix) {
 	H.MulElem(H, update)
 }
 
+// FLOPs of muUpdateH on an H with cols cols: Mul, DivElem & MulElem
+func muUpdateHFlops(cols int) float64 {
+	return mulFlops(k, k, cols) + 2*elemFlops(k, cols)
+}
+
+// makeA - the input matrix, A[i][j] = i*n + j (or the synthetic A, see synth.go,
+// or the file's, see input.go)
+func makeA() (*mat.Dense, error) {
+	switch dataKind {
+	case dataSynthetic:
+		return synthPiece(0, m, 0, n), nil
+	case dataFile:
+		return readBlock(0, m, 0, n)
+	}
+	a := make([]float64, m*n)
+	for i := 0; i < m*n; i++ {
+		a[i] = float64(i) // / 10 // make smaller values, overflow error?
+	}
+	return mat.NewDense(m, n, a), nil
+}
+
+// assembleW - W from the nodes' Wij, node blocks placed by the offset tables
+func assembleW(wPieces []mat.Dense) *mat.Dense {
+	w := make([]float64, m*k)
+	for i := 0; i < numNodes; i++ {
+		for j := 0; j < wRows[i]; j++ {
+			for l := 0; l < k; l++ {
+				w[((wRowStart[i]+j)*k)+l] = wPieces[i].At(j, l)
+			}
+		}
+	}
+	return mat.NewDense(m, k, w)
+}
+
+// assembleH - H from the nodes' Hji, node blocks placed by the offset tables
+// (node (i,j)'s block sits inside column block j, not at position nodeID)
+func assembleH(hPieces []mat.Dense) *mat.Dense {
+	h := make([]float64, k*n)
+	for j := 0; j < k; j++ {
+		for i := 0; i < numNodes; i++ {
+			for l := 0; l < hCols[i]; l++ {
+				h[(j*n)+hColStart[i]+l] = hPieces[i].At(j, l)
+			}
+		}
+	}
+	return mat.NewDense(k, n, h)
+}
+
 func partitionAMatrix(A *mat.Dense) []mat.Matrix {
 	var piecesOfA []mat.Matrix
 
 	for i := 0; i < numNodeRows; i++ {
 		for j := 0; j < numNodeCols; j++ {
-			aPiece := A.Slice(largeBlockSizeW*i, largeBlockSizeW*(i+1), largeBlockSizeH*j, largeBlockSizeH*(j+1))
+			aPiece := A.Slice(aRowOffsets[i], aRowOffsets[i+1], aColOffsets[j], aColOffsets[j+1])
 			// Make pieces each their own copies of the data
 			piecesOfA = append(piecesOfA, mat.DenseCopyOf(aPiece))
 		}
@@ -118,61 +224,85 @@ func partitionAMatrix(A *mat.Dense) []mat.Matrix {
 	return piecesOfA
 }
 
-func makeNode(chans [numNodes]chan MatMessage, akChans [numNodes]chan bool, clientChan chan MatMessage, id int, aPiece mat.Matrix) *Node {
+// makeAPiece - node id's block of A without building all of A (same values as makeA)
+func makeAPiece(id int) (mat.Matrix, error) {
+	rows, cols := aPieceRows(id), aPieceCols(id)
+	rowStart, colStart := aRowOffsets[nodeRow(id)], aColOffsets[nodeCol(id)]
+	switch dataKind {
+	case dataSynthetic:
+		return synthPiece(rowStart, rows, colStart, cols), nil
+	case dataFile:
+		return readBlock(rowStart, rows, colStart, cols)
+	}
+	a := make([]float64, rows*cols)
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			a[(i*cols)+j] = float64(((rowStart + i) * n) + colStart + j)
+		}
+	}
+	return mat.NewDense(rows, cols, a), nil
+}
+
+func makeNode(world *Communicator, clientChan chan MatMessage, aPiece mat.Matrix, seed int64) *Node {
+	id := world.Rank()
 	return &Node{
 		nodeID:     id,
-		nodeChans:  chans,
-		nodeAks:    akChans,
-		inChan:     chans[id],
+		world:      world,
 		aPiece:     aPiece,
-		aks:        akChans[id],
 		clientChan: clientChan,
+		seed:       seed,
 	}
 }
 
-func makeMatrixChans() [numNodes]chan MatMessage {
-	var chans [numNodes]chan MatMessage
-	for ch := range chans {
-		chans[ch] = make(chan MatMessage, numNodes*3)
-	}
-	return chans
-}
-
-func makeAkChans() [numNodes]chan bool {
-	var chans [numNodes]chan bool
+func makeMatrixChans(p int) []chan MatMessage {
+	chans := make([]chan MatMessage, p)
 	for ch := range chans {
-		chans[ch] = make(chan bool, numNodes*3)
+		chans[ch] = make(chan MatMessage, p*3)
 	}
 	return chans
 }
 
 var wg sync.WaitGroup
 
-// Constraints (on m,n,p,p_r,p_c):
-// p_r x p_c must = p (grid)
-// m / p_r must = p
-// n / p_c must = p
-
-//const m, n, k = 16384, 8192, 400
-//const numNodes, numNodeRows, numNodeCols = 512, 32, 16
-
-const m, n, k = 2048, 1024, 400
-const numNodes, numNodeRows, numNodeCols = 128, 16, 8
-
-const largeBlockSizeW = m / numNodeRows
-const largeBlockSizeH = n / numNodeCols
-const smallBlockSizeW = m / numNodes
-const smallBlockSizeH = n / numNodes
-
 func main() {
-	maxIter := 100
+	cfg, err := parseConfig(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		os.Exit(2)
+	}
+	if cfg.DryRun {
+		printPlans(os.Stdout, cfg, planGrids(cfg))
+		fmt.Printf("Using %d x %d grid\n", cfg.NodeRows, cfg.NodeCols)
+		return
+	}
+	applyConfig(cfg)
+	maxIter := cfg.MaxIter
+	if cfg.CrossCheck {
+		if err := crossCheck(os.Stdout, cfg); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if cfg.Engine == engineDES {
+		simulate(cfg)
+		return
+	}
+	if cfg.Rank >= 0 {
+		// a node process started by launch
+		if err := runTCPNode(cfg); err != nil {
+			fatal(err)
+		}
+		return
+	}
 
-	// Initialize input matrix A
-	a := make([]float64, m*n)
-	for i := 0; i < m*n; i++ {
-		a[i] = float64(i) // / 10 // make smaller values, overflow error?
+	if dataKind == dataSynthetic && plantedDir != "" {
+		if err := savePlanted(plantedDir); err != nil {
+			fatal(err)
+		}
 	}
-	A := mat.NewDense(m, n, a)
 	//aRows, aCols := A.Dims()
 	//fmt.Println("A dims:", aRows, aCols)
 	//fmt.Println("W dims:", m, k)
@@ -180,24 +310,37 @@ func main() {
 	//fmt.Println("\nA:")
 	//matPrint(A)
 
-	// Partition A into pieces for nodes
-	piecesOfA := partitionAMatrix(A)
-	// Init nodes
-	chans := makeMatrixChans()
-	akChans := makeAkChans()
 	clientChan := make(chan MatMessage, numNodes*3)
-	var nodes [numNodes]*Node
-	for i := 0; i < numNodes; i++ {
-		id := i
-		nodes[i] = makeNode(chans, akChans, clientChan, id, piecesOfA[i])
-	}
+	var nodes []*Node
+	var stats []*CommStats
+	var clocks []*SimClock
+	var startTime time.Time
+	if cfg.Transport == transportTCP {
+		// a process per node, each makes its own piece of A
+		startTime = time.Now()
+		stats, clocks, err = launch(cfg, clientChan)
+		if err != nil {
+			fatal(err)
+		}
+	} else {
+		// Init nodes, each with its own piece of A (all of A is never made, see makeAPiece)
+		worldComms := makeWorldComms(makeChanTransports(makeMatrixChans(numNodes)))
+		nodes = make([]*Node, numNodes)
+		for i := 0; i < numNodes; i++ {
+			aPiece, err := makeAPiece(i)
+			if err != nil {
+				fatal(err)
+			}
+			nodes[i] = makeNode(worldComms[i], clientChan, aPiece, cfg.Seed)
+		}
 
-	startTime := time.Now()
+		startTime = time.Now()
 
-	// Launch nodes with their A pieces
-	for _, node := range nodes {
-		wg.Add(1)
-		go parallelNMF(node, maxIter)
+		// Launch nodes with their A pieces
+		for _, node := range nodes {
+			wg.Add(1)
+			go nmfProgram()(node, maxIter)
+		}
 	}
 
 	// Wait for W & H blocks from nodes
@@ -214,45 +357,79 @@ func main() {
 	}
 	wg.Wait()
 
-	// Construct W
-	w := make([]float64, m*k)
-	for i := 0; i < numNodes; i++ {
-		for j := 0; j < smallBlockSizeW; j++ {
-			for l := 0; l < k; l++ {
-				w[(i*smallBlockSizeW*k)+(j*k)+l] = wPieces[i].At(j, l)
-			}
-		}
-	}
-	W := mat.NewDense(m, k, w)
-
-	// Construct H
-	h := make([]float64, k*n)
-	for j := 0; j < k; j++ {
-		for i := 0; i < numNodes; i++ {
-			for l := 0; l < smallBlockSizeH; l++ {
-				h[(j*numNodes*smallBlockSizeH)+(i*smallBlockSizeH)+l] = hPieces[i].At(j, l)
-			}
-		}
-	}
-	H := mat.NewDense(k, n, h)
+	W, H := assembleW(wPieces), assembleH(hPieces)
 
 	// fmt.Println("\nW:")
 	// matPrint(W)
 	// fmt.Println("\nH:")
 	// matPrint(H)
 
-	approxA := &mat.Dense{}
-	approxA.Mul(W, H)
-	// Truncate values of A to no decimal for ease
-	aA := make([]float64, m*n)
-	for i := 0; i < m; i++ {
-		for j := 0; j < n; j++ {
-			aA[(i*n)+j] = math.Round(approxA.At(i, j))
-		}
-	}
-	approxA = mat.NewDense(m, n, aA)
 	duration := time.Now().Sub(startTime)
-	//fmt.Println("\nApproximation of A:")
-	//matPrint(approxA)
 	fmt.Println("Took", duration)
+	if nodes != nil {
+		stats, clocks = make([]*CommStats, numNodes), make([]*SimClock, numNodes)
+		for i, node := range nodes {
+			stats[i], clocks[i] = node.world.stats, node.world.clock
+		}
+	}
+	printCommStats(stats)
+	printSimTimes(clocks, cfg)
+	if dataKind == dataSynthetic {
+		reportRecovery(os.Stdout, W, H)
+	}
+}
+
+// simulate - the des engine: replay the schedule without the math (see des.go)
+func simulate(cfg Config) {
+	startTime := time.Now()
+	nodes, err := runDES(cfg.MaxIter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println("Took", time.Now().Sub(startTime))
+
+	stats, clocks := make([]*CommStats, numNodes), make([]*SimClock, numNodes)
+	for i, node := range nodes {
+		node.clock.Iters = node.iter
+		stats[i], clocks[i] = &node.stats, node.clock
+	}
+	printCommStats(stats)
+	printSimTimes(clocks, cfg)
+}
+
+// printCommStats - messages & words sent, in total and by the busiest node
+func printCommStats(nodeStats []*CommStats) {
+	var total, busiest CommStats
+	for _, stats := range nodeStats {
+		total.Messages += stats.Messages
+		total.Words += stats.Words
+		if stats.Words > busiest.Words {
+			busiest = *stats
+		}
+	}
+	fmt.Printf("Sent %d messages, %d words (busiest node: %d messages, %d words)\n",
+		total.Messages, total.Words, busiest.Messages, busiest.Words)
+}
+
+// printSimTimes - predicted time on the simulated network, for the node that finished last
+// Compute is predicted from FLOPs if there's a FLOP rate, else measured (see compute.go)
+func printSimTimes(clocks []*SimClock, cfg Config) {
+	last := clocks[0]
+	for _, clock := range clocks {
+		if clock.Now > last.Now {
+			last = clock
+		}
+	}
+	contention := ""
+	if cfg.Contention {
+		contention = ", with link contention"
+	}
+	computeModel := "measured"
+	if cfg.FlopRate > 0 {
+		computeModel = fmt.Sprintf("%g GFLOP/s", cfg.FlopRate/1e9)
+	}
+	fmt.Printf("Simulated time: %s (communication %s, compute %s) on alpha = %gs, beta = %gs/byte%s, compute %s\n",
+		formatSeconds(last.Now), formatSeconds(last.Comm), formatSeconds(last.Compute), cfg.Alpha, cfg.Beta, contention, computeModel)
+	printPhases(os.Stdout, last)
 }
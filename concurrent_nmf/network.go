@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Simulated network
+// Goroutines on one machine say nothing about a real cluster's network, so every
+// message also advances the simulated clocks of its sender & receiver:
+//	send 	- sender is busy for sendTime (one message at a time, like the alpha-beta
+//			  cost analysis in MPI-FAUN), the message arrives when the sender is done
+//	recv 	- receiver's clock jumps to the arrival time if it's behind
+// Time is in seconds.
+
+// NetworkModel - how long messages take on the simulated network
+type NetworkModel interface {
+	// sendTime - how long the sender is busy sending bytes
+	sendTime(bytes int) float64
+	// arrival - when a message of bytes, finished sending at done, is received by world node dest
+	arrival(dest int, done float64, bytes int) float64
+}
+
+// AlphaBeta - latency alpha per message, beta per byte, no contention
+type AlphaBeta struct {
+	Alpha float64 // seconds per message
+	Beta  float64 // seconds per byte
+}
+
+func (net AlphaBeta) sendTime(bytes int) float64 {
+	return net.Alpha + net.Beta*float64(bytes)
+}
+
+func (net AlphaBeta) arrival(dest int, done float64, bytes int) float64 {
+	return done
+}
+
+// ContendedAlphaBeta - alpha-beta, but each node's incoming link carries one message at a time
+// A message is on the link for beta x bytes & can't arrive before its sender is done,
+// so it takes the first gap that long in the link's busy intervals, from then on.
+// The intervals are in simulated time, so a sender that's behind (the goroutine engine
+// runs nodes in whatever order they get scheduled) still gets the link as it was back
+// then, not after messages that are later in simulated time.
+type ContendedAlphaBeta struct {
+	AlphaBeta
+	mu   sync.Mutex
+	busy [][]interval // each node's incoming link: when it's busy, sorted & disjoint
+}
+
+// interval - [start, end) in simulated time
+type interval struct{ start, end float64 }
+
+func newContendedAlphaBeta(net AlphaBeta, p int) *ContendedAlphaBeta {
+	return &ContendedAlphaBeta{
+		AlphaBeta: net,
+		busy:      make([][]interval, p),
+	}
+}
+
+func (net *ContendedAlphaBeta) arrival(dest int, done float64, bytes int) float64 {
+	transfer := net.Beta * float64(bytes)
+	net.mu.Lock()
+	defer net.mu.Unlock()
+	busy := net.busy[dest]
+	start := done - transfer
+	i := sort.Search(len(busy), func(i int) bool { return busy[i].end > start })
+	for ; i < len(busy) && busy[i].start < start+transfer; i++ {
+		start = busy[i].end // doesn't fit before busy[i]
+	}
+	end := start + transfer
+	if transfer == 0 {
+		return end
+	}
+
+	// busy[i] is the first interval after it, merge it with the ones it touches
+	lo, hi, merged := i, i, interval{start, end}
+	if lo > 0 && busy[lo-1].end == start {
+		lo--
+		merged.start = busy[lo].start
+	}
+	if hi < len(busy) && busy[hi].start == end {
+		merged.end = busy[hi].end
+		hi++
+	}
+	net.busy[dest] = slices.Replace(busy, lo, hi, merged)
+	return end
+}
+
+// Network used by the communicators, set from the Config by applyConfig
+var network NetworkModel = AlphaBeta{}
+
+func makeNetwork(cfg Config) NetworkModel {
+	net := AlphaBeta{Alpha: cfg.Alpha, Beta: cfg.Beta}
+	if cfg.Contention {
+		return newContendedAlphaBeta(net, cfg.NumNodes)
+	}
+	return net
+}
+
+// SimClock - one node's simulated time, shared by all of its communicators
+type SimClock struct {
+	Now     float64
+	Comm    float64 // sending & waiting for messages
+	Compute float64 // local kernels, see compute.go
+	Iters   int     // iterations run (a run can stop early, see convergence.go)
+	setup   bool    // sends aren't charged, see handOff & init.go
+
+	phase   string             // what time is charged to right now
+	ByPhase map[string]float64 // time by phase
+	Flops   map[string]float64 // FLOPs by (compute) phase
+}
+
+func newSimClock() *SimClock {
+	return &SimClock{
+		ByPhase: make(map[string]float64),
+		Flops:   make(map[string]float64),
+	}
+}
+
+func (clock *SimClock) advanceComm(dt float64) {
+	clock.Now += dt
+	clock.Comm += dt
+	clock.ByPhase[clock.phase] += dt
+}
+
+// waitUntil - receiving a message that arrives at t
+func (clock *SimClock) waitUntil(t float64) {
+	if t > clock.Now {
+		clock.advanceComm(t - clock.Now)
+	}
+}
+
+func (clock *SimClock) advanceCompute(dt float64) {
+	clock.Now += dt
+	clock.Compute += dt
+	clock.ByPhase[clock.phase] += dt
+}
+
+// formatSeconds - simulated times are floats, print them like durations
+func formatSeconds(s float64) string {
+	switch {
+	case s >= 1:
+		return fmt.Sprintf("%.3fs", s)
+	case s >= 1e-3:
+		return fmt.Sprintf("%.3fms", s*1e3)
+	default:
+		return fmt.Sprintf("%.3fµs", s*1e6)
+	}
+}
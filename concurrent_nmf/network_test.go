@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+)
+
+// TestContendedArrival - messages to a node take the first gap on its link in
+// simulated time, whatever order they're sent in
+func TestContendedArrival(t *testing.T) {
+	net := newContendedAlphaBeta(AlphaBeta{Alpha: 0, Beta: 1}, 2)
+	steps := []struct {
+		dest  int
+		done  float64
+		bytes int
+		want  float64
+		name  string
+	}{
+		{0, 10, 2, 10, "link free: [8, 10)"},
+		{0, 3, 2, 3, "behind in simulated time, the link was free then: [1, 3)"},
+		{0, 9, 2, 12, "overlaps [8, 10): [10, 12)"},
+		{1, 9, 2, 9, "other link"},
+		{0, 8, 5, 8, "fills [3, 8) exactly, [1, 12) is all busy now"},
+		{0, 5, 1, 13, "no gap left before 12: [12, 13)"},
+		{0, 20, 0, 20, "nothing to transfer"},
+	}
+	for _, s := range steps {
+		if got := net.arrival(s.dest, s.done, s.bytes); got != s.want {
+			t.Fatalf("%s: arrives at %g, want %g", s.name, got, s.want)
+		}
+	}
+	if got := len(net.busy[0]); got != 1 {
+		t.Errorf("link 0 has %d busy intervals, want 1 (they touch): %v", got, net.busy[0])
+	}
+}
+
+// TestContendedOrder - the same messages sent in any order arrive at the same times
+// when none of them tie for a gap
+func TestContendedOrder(t *testing.T) {
+	type msg struct {
+		done  float64
+		bytes int
+	}
+	// message i is sent at 3i, takes 2: every link is busy 2 of every 3
+	var msgs []msg
+	for i := 1; i <= 50; i++ {
+		msgs = append(msgs, msg{float64(3 * i), 2})
+	}
+	want := make(map[msg]float64)
+	inOrder := newContendedAlphaBeta(AlphaBeta{Beta: 1}, 1)
+	for _, m := range msgs {
+		want[m] = inOrder.arrival(0, m.done, m.bytes)
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	for trial := 0; trial < 10; trial++ {
+		net := newContendedAlphaBeta(AlphaBeta{Beta: 1}, 1)
+		for _, i := range rng.Perm(len(msgs)) {
+			if got := net.arrival(0, msgs[i].done, msgs[i].bytes); got != want[msgs[i]] {
+				t.Fatalf("trial %d: message sent at %g arrives at %g, in order %g", trial, msgs[i].done, got, want[msgs[i]])
+			}
+		}
+	}
+}
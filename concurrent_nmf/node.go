@@ -9,23 +9,28 @@ import (
 // Node - has info each goroutine needs
 type Node struct {
 	nodeID     int
-	nodeChans  [numNodes]chan MatMessage
-	nodeAks    [numNodes]chan bool
-	aks        chan bool
-	inChan     chan MatMessage
+	world      *Communicator // all nodes
+	rowComm    *Communicator // nodes in my grid row, set up by splitGrid
+	colComm    *Communicator // nodes in my grid column, set up by splitGrid
 	clientChan chan MatMessage
 	aPiece     mat.Matrix
+	seed       int64 // of the init, see nmfcore.RNG
 }
 
 // MatMessage - give sender ID & extra info along with matrix
 type MatMessage struct {
 	mtx      mat.Dense
+	comm     int // context id of the communicator it was sent on
 	sentID   int
-	isFinalW bool // for return to client
-	isFinalH bool // for return to client
+	tag      int     // which collective (or user message) it belongs to
+	epoch    int     // which iteration it belongs to
+	isFinalW bool    // for return to client
+	isFinalH bool    // for return to client
+	arrival  float64 // simulated time it gets to the receiver (see network.go)
 }
 
 // Implement MPI collectives
+// Each one only exchanges messages within its communicator (see communicator.go)
 //	- reduce-scatter 	- used across all proc rows/columns
 //		every node retrieve V/Y from every node
 //		every node performs reduction & returns piece of reduction
@@ -36,89 +41,91 @@ type MatMessage struct {
 //		every node retrieve U/X from every node
 //		every node performs & returns reduction
 
-// Remember - sending a variable thru channel, is giving away that memory (can't use it afterwards - null pointer)
+// Remember - sending a matrix shares its memory with the receiver unless -sendmode copy
+// (see the send modes in communicator.go)
 
-// Utility Functions
-func in(slice []int, val int) bool {
-	for _, item := range slice {
-		if item == val {
-			return true
-		}
-	}
-	return false
+// splitGrid - derive row & column communicators from the world (collective)
+// Row comm rank = grid column, col comm rank = grid row
+func (node *Node) splitGrid() {
+	node.rowComm = node.world.Split(nodeRow(node.nodeID), nodeCol(node.nodeID))
+	node.colComm = node.world.Split(nodeCol(node.nodeID), nodeRow(node.nodeID))
 }
 
-func (node *Node) localReduce(parts []mat.Dense) mat.Dense {
-	start := parts[0]
-	for i := 1; i < len(parts); i++ {
-		start.Add(&start, &parts[i])
-	}
-	return start
+// setEpoch - tag everything the node sends from now on with iteration iter
+func (node *Node) setEpoch(iter int) {
+	node.world.SetEpoch(iter)
+	node.rowComm.SetEpoch(iter)
+	node.colComm.SetEpoch(iter)
 }
 
-func (node *Node) allReduce(part *mat.Dense) *mat.Dense {
-	// send out my part
-	for i, c := range node.nodeChans {
-		if i != node.nodeID {
-			c <- MatMessage{
-				mtx:    *part,
-				sentID: node.nodeID,
-			}
-		}
-	}
-
-	parts := make([]mat.Dense, numNodes)
-	parts[node.nodeID] = *part
+// Utility Functions
 
-	// get parts from each other node
-	done := 1
-	for done < numNodes {
-		next := <-node.inChan
-		parts[next.sentID] = next.mtx
-		node.nodeAks[next.sentID] <- true
-		done++
+// localReduce - sum of parts, in a new matrix
+// (adding into parts[0] would change another node's matrix in share mode)
+func localReduce(parts []mat.Dense) mat.Dense {
+	var sum mat.Dense
+	sum.CloneFrom(&parts[0])
+	for i := 1; i < len(parts); i++ {
+		sum.Add(&sum, &parts[i])
 	}
+	return sum
+}
 
-	// put those parts together
-	ret := node.localReduce(parts)
+// wCounts - words in each Wij of grid row row, by grid column (row comm rank)
+func wCounts(row int) []int {
+	counts := make([]int, numNodeCols)
+	for j := range counts {
+		counts[j] = wRows[row*numNodeCols+j] * k
+	}
+	return counts
+}
 
-	// wait for all others to have received my matrix
-	for i := 0; i < numNodes-1; i++ {
-		<-node.aks
+// hCounts - words in each Hji of grid column col, by grid row (col comm rank)
+func hCounts(col int) []int {
+	counts := make([]int, numNodeRows)
+	for i := range counts {
+		counts[i] = k * hCols[i*numNodeCols+col]
 	}
+	return counts
+}
 
-	return &ret
+func (node *Node) allReduce(part *mat.Dense) *mat.Dense {
+	node.startPhase(phaseAllReduce)
+	// algorithm picked per run, see allreduce.go
+	return node.world.allReduce(part, allReduceAlgo)
 }
 
 func (node *Node) localConcatenateColWise(parts []mat.Dense) mat.Dense {
 	// Perform concatenate column-wise
+	// parts[i] = Hji of node (i, thisCol), placed by the offset tables
+	thisCol := nodeCol(node.nodeID)
+	largeBlockSizeH := aPieceCols(node.nodeID)
 	x := make([]float64, k*largeBlockSizeH)
 	for j := 0; j < k; j++ {
 		for i := 0; i < numNodeRows; i++ {
-			// if node.nodeID == 0 && j == 0 {
-			// 	fmt.Println("Hji piece from other nodes ( i =", i, "):")
-			// 	matPrint(&parts[i])
-			// }
-			for l := 0; l < smallBlockSizeH; l++ {
-				x[(j*numNodeRows*smallBlockSizeH)+(i*smallBlockSizeH)+l] = parts[i].At(j, l)
+			id := i*numNodeCols + thisCol
+			off := hLocalStart(id)
+			for l := 0; l < hCols[id]; l++ {
+				x[(j*largeBlockSizeH)+off+l] = parts[i].At(j, l)
 			}
 		}
 	}
-	// if node.nodeID == 0 {
-	// 	fmt.Println("x (size =", len(x), "):", x)
-	// }
 
 	return *mat.NewDense(k, largeBlockSizeH, x)
 }
 
 func (node *Node) localConcatenateRowWise(parts []mat.Dense) mat.Dense {
 	// Perform concatenate row-wise
+	// parts[j] = Wij of node (thisRow, j), placed by the offset tables
+	thisRow := nodeRow(node.nodeID)
+	largeBlockSizeW := aPieceRows(node.nodeID)
 	x := make([]float64, largeBlockSizeW*k)
 	for i := 0; i < numNodeCols; i++ {
-		for j := 0; j < smallBlockSizeW; j++ {
+		id := thisRow*numNodeCols + i
+		off := wLocalStart(id)
+		for j := 0; j < wRows[id]; j++ {
 			for l := 0; l < k; l++ {
-				x[(i*smallBlockSizeW*k)+(j*k)+l] = parts[i].At(j, l)
-				// x[(j*numNodeRows*smallBlockSizeH)+(i*smallBlockSizeH)+l] = parts[i].At(j, l)
+				x[((off+j)*k)+l] = parts[i].At(j, l)
 			}
 		}
 	}
@@ -126,56 +133,37 @@ func (node *Node) localConcatenateRowWise(parts []mat.Dense) mat.Dense {
 }
 
 func (node *Node) allGatherAcrossNodeColumns(smallColumnBlock *mat.Dense) mat.Matrix {
-	// Only concerned w/ nodes in same column
-	thisCol := node.nodeID % numNodeCols
-	colIDs := make([]int, numNodeRows)
-	colIDsIdx := 0
-	for i := 0; i < numNodes; i++ {
-		if (i % numNodeCols) == thisCol {
-			colIDs[colIDsIdx] = i
-			colIDsIdx++
-		}
+	node.startPhase(phaseAllGather)
+	thisCol := nodeCol(node.nodeID)
+	largeBlockSizeH := aPieceCols(node.nodeID)
+	algo := pickAllGather(allGatherAlgo, k*largeBlockSizeH, numNodeRows)
+	if algo == allGatherNaive {
+		// Only concerned w/ nodes in same column - parts come back indexed by grid row
+		parts := node.colComm.exchange(smallColumnBlock)
+
+		// put those parts together
+		ret := node.localConcatenateColWise(parts)
+		node.colComm.recycle(parts)
+		return &ret
 	}
 
-	// send out my part (send to all for synchronization)
-	for i, c := range node.nodeChans {
-		if i != node.nodeID {
-			c <- MatMessage{
-				mtx:    *smallColumnBlock,
-				sentID: node.nodeID,
-			}
-		}
-	}
+	buf, offsets := node.colComm.allGatherv(denseView(smallColumnBlock), hCounts(thisCol), algo)
 
-	parts := make([]mat.Dense, numNodeRows)
-	thisSmallBlockIndex := node.nodeID / numNodeCols
-	parts[thisSmallBlockIndex] = *smallColumnBlock
-
-	// get parts from each other node (only record if node in same column)
-	done := 1
-	for done < numNodes {
-		next := <-node.inChan
-		if in(colIDs, next.sentID) {
-			thisSmallBlockIndex := next.sentID / numNodeCols
-			parts[thisSmallBlockIndex] = next.mtx
+	// Each Hji is k x (n/p) row-major, so its rows are contiguous runs in Hj's rows
+	x := make([]float64, k*largeBlockSizeH)
+	for i := 0; i < numNodeRows; i++ {
+		id := i*numNodeCols + thisCol
+		off, cols := hLocalStart(id), hCols[id]
+		for j := 0; j < k; j++ {
+			copy(x[(j*largeBlockSizeH)+off:], buf[offsets[i]+(j*cols):offsets[i]+((j+1)*cols)])
 		}
-		node.nodeAks[next.sentID] <- true
-		done++
 	}
-
-	// put those parts together
-	ret := node.localConcatenateColWise(parts)
-
-	// wait for all others to have received my matrix
-	for i := 0; i < numNodes-1; i++ {
-		<-node.aks
-	}
-
-	return &ret
+	return mat.NewDense(k, largeBlockSizeH, x)
 }
 
 func (node *Node) allGatherAcrossNodeColumnsDummy(smallColumnBlock *mat.Dense) mat.Matrix {
 	// fmt.Println(node.nodeID, "["+strconv.Itoa(node.state)+"]in allGatherCol")
+	largeBlockSizeH := aPieceCols(node.nodeID)
 	x := make([]float64, k*largeBlockSizeH)
 	for i := range x {
 		x[i] = rand.NormFloat64()
@@ -185,56 +173,28 @@ func (node *Node) allGatherAcrossNodeColumnsDummy(smallColumnBlock *mat.Dense) m
 }
 
 func (node *Node) allGatherAcrossNodeRows(smallRowBlock *mat.Dense) mat.Matrix {
-	// Only concerned w/ nodes in same row
-	thisRow := node.nodeID / numNodeCols
-	rowIDs := make([]int, numNodeCols)
-	rowIDsIdx := 0
-	for i := 0; i < numNodes; i++ {
-		if (i / numNodeCols) == thisRow {
-			rowIDs[rowIDsIdx] = i
-			rowIDsIdx++
-		}
-	}
-
-	// send out my part (send to all for synchronization)
-	for i, c := range node.nodeChans {
-		if i != node.nodeID {
-			c <- MatMessage{
-				mtx:    *smallRowBlock,
-				sentID: node.nodeID,
-			}
-		}
-	}
-
-	parts := make([]mat.Dense, numNodeCols)
-	thisSmallBlockIndex := node.nodeID % numNodeCols
-	parts[thisSmallBlockIndex] = *smallRowBlock
-
-	// get parts from each other node (only record if node in same row)
-	done := 1
-	for done < numNodes {
-		next := <-node.inChan
-		if in(rowIDs, next.sentID) {
-			thisSmallBlockIndex := next.sentID % numNodeCols
-			parts[thisSmallBlockIndex] = next.mtx
-		}
-		node.nodeAks[next.sentID] <- true
-		done++
-	}
-
-	// put those parts together
-	ret := node.localConcatenateRowWise(parts)
-
-	// wait for all others to have received my matrix
-	for i := 0; i < numNodes-1; i++ {
-		<-node.aks
+	node.startPhase(phaseAllGather)
+	thisRow := nodeRow(node.nodeID)
+	largeBlockSizeW := aPieceRows(node.nodeID)
+	algo := pickAllGather(allGatherAlgo, largeBlockSizeW*k, numNodeCols)
+	if algo == allGatherNaive {
+		// Only concerned w/ nodes in same row - parts come back indexed by grid column
+		parts := node.rowComm.exchange(smallRowBlock)
+
+		// put those parts together
+		ret := node.localConcatenateRowWise(parts)
+		node.rowComm.recycle(parts)
+		return &ret
 	}
 
-	return &ret
+	// Wij blocks are (m/p) x k row-major & stack in rank order, so the gathered buffer is Wi
+	buf, _ := node.rowComm.allGatherv(denseView(smallRowBlock), wCounts(thisRow), algo)
+	return mat.NewDense(largeBlockSizeW, k, buf)
 }
 
 func (node *Node) allGatherAcrossNodeRowsDummy(smallRowBlock *mat.Dense) mat.Matrix {
 	// fmt.Println(node.nodeID, "["+strconv.Itoa(node.state)+"]in allGatherRow")
+	largeBlockSizeW := aPieceRows(node.nodeID)
 	x := make([]float64, largeBlockSizeW*k)
 	for i := range x {
 		x[i] = rand.NormFloat64()
@@ -245,129 +205,78 @@ func (node *Node) allGatherAcrossNodeRowsDummy(smallRowBlock *mat.Dense) mat.Mat
 }
 
 func (node *Node) reduceScatterAcrossNodeRows(smallRowBlock *mat.Dense) mat.Matrix {
-	// Only concerned w/ nodes in same row
-	thisRow := node.nodeID / numNodeCols
-	rowIDs := make([]int, numNodeCols)
-	rowIDsIdx := 0
-	for i := 0; i < numNodes; i++ {
-		if (i / numNodeCols) == thisRow {
-			rowIDs[rowIDsIdx] = i
-			rowIDsIdx++
-		}
-	}
-
-	// send out my part (send to all for synchronization)
-	for i, c := range node.nodeChans {
-		if i != node.nodeID {
-			c <- MatMessage{
-				mtx:    *smallRowBlock,
-				sentID: node.nodeID,
-			}
-		}
-	}
-
-	parts := make([]mat.Dense, numNodeCols)
-	thisSmallBlockIndex := node.nodeID % numNodeCols
-	parts[thisSmallBlockIndex] = *smallRowBlock
-
-	// get parts from each other node (only record if node in same row)
-	done := 1
-	for done < numNodes {
-		next := <-node.inChan
-		if in(rowIDs, next.sentID) {
-			thisSmallBlockIndex := next.sentID % numNodeCols
-			parts[thisSmallBlockIndex] = next.mtx
-		}
-		node.nodeAks[next.sentID] <- true
-		done++
-	}
-
-	// put those parts together
-	reduceProduct := node.localReduce(parts)
-
-	// scatter reduceProduct to others in row evenly
-	ret := reduceProduct.Slice(thisSmallBlockIndex*smallBlockSizeW, (thisSmallBlockIndex+1)*smallBlockSizeW, 0, k)
-
-	// wait for all others to have received my matrix
-	for i := 0; i < numNodes-1; i++ {
-		<-node.aks
+	node.startPhase(phaseReduceScatter)
+	thisRow := nodeRow(node.nodeID)
+	algo := pickReduceScatter(reduceScatterAlgo, aPieceRows(node.nodeID)*k, numNodeCols)
+	if algo == reduceScatterNaive {
+		// Only concerned w/ nodes in same row
+		parts := node.rowComm.exchange(smallRowBlock)
+
+		// put those parts together
+		reduceProduct := localReduce(parts)
+		node.rowComm.recycle(parts)
+
+		// scatter reduceProduct to others in row (by the offset tables)
+		start := wLocalStart(node.nodeID)
+		return reduceProduct.Slice(start, start+wRows[node.nodeID], 0, k)
 	}
 
-	return ret
+	// Vij is (m/p_r) x k row-major, the rows for node (i,j) are a contiguous run -
+	// send each node in the row only its rows
+	mine := node.rowComm.reduceScatterv(denseData(smallRowBlock), wCounts(thisRow), algo)
+	return mat.NewDense(wRows[node.nodeID], k, mine)
 }
 
 func (node *Node) reduceScatterAcrossNodeColumns(smallColumnBlock *mat.Dense) mat.Matrix {
-	// Only concerned w/ nodes in same column
-	thisCol := node.nodeID % numNodeCols
-	colIDs := make([]int, numNodeRows)
-	colIDsIdx := 0
-	for i := 0; i < numNodes; i++ {
-		if (i % numNodeCols) == thisCol {
-			colIDs[colIDsIdx] = i
-			colIDsIdx++
-		}
+	node.startPhase(phaseReduceScatter)
+	thisCol := nodeCol(node.nodeID)
+	algo := pickReduceScatter(reduceScatterAlgo, k*aPieceCols(node.nodeID), numNodeRows)
+	if algo == reduceScatterNaive {
+		// Only concerned w/ nodes in same column
+		parts := node.colComm.exchange(smallColumnBlock)
+
+		// put those parts together
+		reduceProduct := localReduce(parts)
+		node.colComm.recycle(parts)
+
+		// scatter reduceProduct to others in column (by the offset tables)
+		start := hLocalStart(node.nodeID)
+		return reduceProduct.Slice(0, k, start, start+hCols[node.nodeID])
 	}
 
-	// send out my part (send to all for synchronization)
-	for i, c := range node.nodeChans {
-		if i != node.nodeID {
-			c <- MatMessage{
-				mtx:    *smallColumnBlock,
-				sentID: node.nodeID,
-			}
+	// Yij is k x (n/p_c) row-major, the columns for node (i,j) aren't contiguous -
+	// pack them so block i is node (i,j)'s k x (n/p) piece, row-major
+	data := make([]float64, 0, k*aPieceCols(node.nodeID))
+	for i := 0; i < numNodeRows; i++ {
+		id := i*numNodeCols + thisCol
+		start := hLocalStart(id)
+		for j := 0; j < k; j++ {
+			data = append(data, smallColumnBlock.RawRowView(j)[start:start+hCols[id]]...)
 		}
 	}
-
-	parts := make([]mat.Dense, numNodeRows)
-	thisSmallBlockIndex := node.nodeID / numNodeCols
-	parts[thisSmallBlockIndex] = *smallColumnBlock
-
-	// get parts from each other node (only record if node in same column)
-	done := 1
-	for done < numNodes {
-		// for done < numNodeRows {
-		next := <-node.inChan
-		if in(colIDs, next.sentID) {
-			thisSmallBlockIndex := next.sentID / numNodeCols
-			parts[thisSmallBlockIndex] = next.mtx
-		}
-		node.nodeAks[next.sentID] <- true
-		done++
-	}
-
-	// put those parts together
-	reduceProduct := node.localReduce(parts)
-
-	// scatter reduceProduct to others in row evenly
-	ret := reduceProduct.Slice(0, k, thisSmallBlockIndex*smallBlockSizeH, (thisSmallBlockIndex+1)*smallBlockSizeH)
-
-	// wait for all others to have received my matrix
-	for i := 0; i < numNodes-1; i++ {
-		<-node.aks
-	}
-
-	return ret
+	mine := node.colComm.reduceScatterv(data, hCounts(thisCol), algo)
+	return mat.NewDense(k, hCols[node.nodeID], mine)
 }
 
 // Combine these 2 methods into 1?
 func (node *Node) reduceScatterAcrossNodeRowsDummy(smallProductMatrix *mat.Dense) *mat.Dense {
 	// fmt.Println(node.nodeID, "["+strconv.Itoa(node.state)+"]in reduceScatterRow")
-	x := make([]float64, smallBlockSizeW*k)
+	x := make([]float64, wRows[node.nodeID]*k)
 	for i := range x {
 		x[i] = rand.NormFloat64()
 	}
 
 	// fmt.Println(node.nodeID, "in reduceScatterRow ALL done!")
-	return mat.NewDense(smallBlockSizeW, k, x)
+	return mat.NewDense(wRows[node.nodeID], k, x)
 }
 
 func (node *Node) reduceScatterAcrossNodeColumnsDummy(smallProductMatrix *mat.Dense) *mat.Dense {
 	// fmt.Println(node.nodeID, "["+strconv.Itoa(node.state)+"]in reduceScatterRow")
-	x := make([]float64, k*smallBlockSizeH)
+	x := make([]float64, k*hCols[node.nodeID])
 	for i := range x {
 		x[i] = rand.NormFloat64()
 	}
 
 	// fmt.Println(node.nodeID, "in reduceScatterCol ALL done!")
-	return mat.NewDense(k, smallBlockSizeH, x)
+	return mat.NewDense(k, hCols[node.nodeID], x)
 }
@@ -0,0 +1,94 @@
+package main
+
+// Ragged block layout
+// m & n don't have to divide evenly by the grid - leftover rows/columns get spread
+// over the first blocks, so block sizes differ by at most 1.
+//
+// Node (i,j) = node i*p_c + j, owns:
+//	A_ij 	- rows aRowOffsets[i]:aRowOffsets[i+1], cols aColOffsets[j]:aColOffsets[j+1]
+//	Wij 	- row block i of A split p_c ways, piece j 	(rows wRowStart[id] : + wRows[id])
+//	Hji 	- col block j of A split p_r ways, piece i 	(cols hColStart[id] : + hCols[id])
+// Which matches what reduce-scatter across node rows/columns hands back to each node.
+
+// Offset tables, set from the Config by applyConfig
+var aRowOffsets, aColOffsets []int
+var wRowStart, wRows []int
+var hColStart, hCols []int
+
+// blockSizes - split total into parts pieces, leftovers go to the first pieces
+func blockSizes(total, parts int) []int {
+	sizes := make([]int, parts)
+	for i := range sizes {
+		sizes[i] = total / parts
+		if i < total%parts {
+			sizes[i]++
+		}
+	}
+	return sizes
+}
+
+// blockOffsets - prefix sums of blockSizes, len = parts+1
+func blockOffsets(total, parts int) []int {
+	offsets := make([]int, parts+1)
+	for i, size := range blockSizes(total, parts) {
+		offsets[i+1] = offsets[i] + size
+	}
+	return offsets
+}
+
+// blockOffset - where piece i starts, blockOffsets(total, parts)[i] without the table
+func blockOffset(total, parts, i int) int {
+	return i*(total/parts) + min(i, total%parts)
+}
+
+func nodeRow(id int) int {
+	return id / numNodeCols
+}
+
+func nodeCol(id int) int {
+	return id % numNodeCols
+}
+
+func makePartition() {
+	aRowOffsets = blockOffsets(m, numNodeRows)
+	aColOffsets = blockOffsets(n, numNodeCols)
+
+	wRowStart, wRows = make([]int, numNodes), make([]int, numNodes)
+	hColStart, hCols = make([]int, numNodes), make([]int, numNodes)
+	for i := 0; i < numNodeRows; i++ {
+		// split row block i of W among the p_c nodes in node row i
+		wOffsets := blockOffsets(aRowOffsets[i+1]-aRowOffsets[i], numNodeCols)
+		for j := 0; j < numNodeCols; j++ {
+			id := i*numNodeCols + j
+			wRowStart[id] = aRowOffsets[i] + wOffsets[j]
+			wRows[id] = wOffsets[j+1] - wOffsets[j]
+		}
+	}
+	for j := 0; j < numNodeCols; j++ {
+		// split col block j of H among the p_r nodes in node column j
+		hOffsets := blockOffsets(aColOffsets[j+1]-aColOffsets[j], numNodeRows)
+		for i := 0; i < numNodeRows; i++ {
+			id := i*numNodeCols + j
+			hColStart[id] = aColOffsets[j] + hOffsets[i]
+			hCols[id] = hOffsets[i+1] - hOffsets[i]
+		}
+	}
+}
+
+// Sizes of this node's blocks of A, Wi (gathered) & Hj (gathered)
+func aPieceRows(id int) int {
+	return aRowOffsets[nodeRow(id)+1] - aRowOffsets[nodeRow(id)]
+}
+
+func aPieceCols(id int) int {
+	return aColOffsets[nodeCol(id)+1] - aColOffsets[nodeCol(id)]
+}
+
+// Where Wij starts inside the gathered Wi (rows), and Hji inside Hj (cols)
+func wLocalStart(id int) int {
+	return wRowStart[id] - aRowOffsets[nodeRow(id)]
+}
+
+func hLocalStart(id int) int {
+	return hColStart[id] - aColOffsets[nodeCol(id)]
+}
@@ -0,0 +1,131 @@
+package main
+
+import "testing"
+
+// setGrid - sizes & offset tables for an m x n A on a p_r x p_c grid (what applyConfig sets)
+func setGrid(rows, cols, pr, pc int) {
+	m, n = rows, cols
+	numNodes, numNodeRows, numNodeCols = pr*pc, pr, pc
+	makePartition()
+}
+
+func TestBlockSizes(t *testing.T) {
+	for _, tc := range []struct{ total, parts int }{
+		{10, 1}, {10, 2}, {10, 3}, {10, 10}, {7, 4}, {2048, 16}, {1023, 7},
+	} {
+		sizes := blockSizes(tc.total, tc.parts)
+		offsets := blockOffsets(tc.total, tc.parts)
+		if len(offsets) != tc.parts+1 || offsets[0] != 0 || offsets[tc.parts] != tc.total {
+			t.Errorf("blockOffsets(%d, %d) = %v, want 0 .. %d", tc.total, tc.parts, offsets, tc.total)
+			continue
+		}
+		for i, size := range sizes {
+			if size != tc.total/tc.parts && size != tc.total/tc.parts+1 {
+				t.Errorf("blockSizes(%d, %d)[%d] = %d, not within 1 of the others", tc.total, tc.parts, i, size)
+			}
+			if i > 0 && size > sizes[i-1] {
+				t.Errorf("blockSizes(%d, %d) = %v, leftovers have to go to the first pieces", tc.total, tc.parts, sizes)
+			}
+			if offsets[i+1]-offsets[i] != size {
+				t.Errorf("blockOffsets(%d, %d) = %v, doesn't match sizes %v", tc.total, tc.parts, offsets, sizes)
+			}
+		}
+		for i := range offsets {
+			if got := blockOffset(tc.total, tc.parts, i); got != offsets[i] {
+				t.Errorf("blockOffset(%d, %d, %d) = %d, want %d", tc.total, tc.parts, i, got, offsets[i])
+			}
+		}
+	}
+}
+
+// TestPartition - every row of W & column of H is owned by exactly one node, inside
+// its grid row's (column's) block of A, & the local starts place it in the gathered Wi (Hj)
+func TestPartition(t *testing.T) {
+	k = 3
+	for _, tc := range []struct{ m, n, pr, pc int }{
+		{16, 8, 2, 2}, {17, 11, 2, 3}, {23, 17, 3, 2}, {9, 9, 3, 3}, {40, 7, 1, 7}, {7, 40, 7, 1}, {5, 5, 1, 1},
+	} {
+		setGrid(tc.m, tc.n, tc.pr, tc.pc)
+		wOwner, hOwner := make([]int, m), make([]int, n)
+		for i := range wOwner {
+			wOwner[i] = -1
+		}
+		for j := range hOwner {
+			hOwner[j] = -1
+		}
+		for id := 0; id < numNodes; id++ {
+			row, col := nodeRow(id), nodeCol(id)
+			if row*numNodeCols+col != id {
+				t.Fatalf("%v: node %d is at (%d, %d)", tc, id, row, col)
+			}
+			if wRows[id] < 1 || hCols[id] < 1 {
+				t.Errorf("%v: node %d owns %d rows of W & %d columns of H", tc, id, wRows[id], hCols[id])
+			}
+			for r := wRowStart[id]; r < wRowStart[id]+wRows[id]; r++ {
+				if wOwner[r] >= 0 {
+					t.Errorf("%v: row %d of W is owned by nodes %d & %d", tc, r, wOwner[r], id)
+				}
+				wOwner[r] = id
+			}
+			for c := hColStart[id]; c < hColStart[id]+hCols[id]; c++ {
+				if hOwner[c] >= 0 {
+					t.Errorf("%v: column %d of H is owned by nodes %d & %d", tc, c, hOwner[c], id)
+				}
+				hOwner[c] = id
+			}
+
+			if wLocalStart(id) < 0 || wLocalStart(id)+wRows[id] > aPieceRows(id) {
+				t.Errorf("%v: node %d's W rows %d:+%d aren't in its row block of A", tc, id, wLocalStart(id), wRows[id])
+			}
+			if hLocalStart(id) < 0 || hLocalStart(id)+hCols[id] > aPieceCols(id) {
+				t.Errorf("%v: node %d's H columns %d:+%d aren't in its column block of A", tc, id, hLocalStart(id), hCols[id])
+			}
+		}
+		for r, id := range wOwner {
+			if id < 0 {
+				t.Errorf("%v: nobody owns row %d of W", tc, r)
+			}
+		}
+		for c, id := range hOwner {
+			if id < 0 {
+				t.Errorf("%v: nobody owns column %d of H", tc, c)
+			}
+		}
+
+		// the gathered blocks stack in rank order, which is what the all-gathers rely on
+		for row := 0; row < numNodeRows; row++ {
+			off := 0
+			for col := 0; col < numNodeCols; col++ {
+				id := row*numNodeCols + col
+				if wLocalStart(id) != off {
+					t.Errorf("%v: node %d's W block starts at %d in Wi, want %d", tc, id, wLocalStart(id), off)
+				}
+				off += wRows[id]
+			}
+			if total := sum(wCounts(row)); total != off*k {
+				t.Errorf("%v: wCounts(%d) adds up to %d, want %d", tc, row, total, off*k)
+			}
+		}
+		for col := 0; col < numNodeCols; col++ {
+			off := 0
+			for row := 0; row < numNodeRows; row++ {
+				id := row*numNodeCols + col
+				if hLocalStart(id) != off {
+					t.Errorf("%v: node %d's H block starts at %d in Hj, want %d", tc, id, hLocalStart(id), off)
+				}
+				off += hCols[id]
+			}
+			if total := sum(hCounts(col)); total != off*k {
+				t.Errorf("%v: hCounts(%d) adds up to %d, want %d", tc, col, total, off*k)
+			}
+		}
+	}
+}
+
+func sum(counts []int) int {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	return total
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Grid planner
+// MPI-FAUN picks p_r x p_c so the grid matches the shape of A (p_r/p_c ~ m/n),
+// which keeps the reduce-scatter/all-gather pieces small. Here we try every
+// factorization of p & estimate what one NMF iteration sends, using the same
+// message pattern as the collectives in node.go.
+
+// GridPlan - a p_r x p_c layout & its estimated per-iteration communication
+type GridPlan struct {
+	NodeRows int
+	NodeCols int
+	Words    int // float64s sent by the busiest node per iteration
+	Messages int // messages sent by each node per iteration
+}
+
+// gridFits - every node gets at least 1 row of W & 1 column of H
+func gridFits(m, n, pr, pc int) bool {
+	return m/pr >= pc && n/pc >= pr
+}
+
+// gridFactorizations - all (p_r, p_c) with p_r x p_c = p
+func gridFactorizations(p int) [][2]int {
+	var grids [][2]int
+	for pr := 1; pr <= p; pr++ {
+		if p%pr == 0 {
+			grids = append(grids, [2]int{pr, p / pr})
+		}
+	}
+	return grids
+}
+
+// estimateComm - count what the node.go collectives send in one iteration on cfg's grid,
+// with the algorithms the run will use (see Config.collectiveAlgos)
+//
+//	lines 4 & 10 	allReduce (world, p) 						k x k, see allReduceCost
+//	line 5 			allGatherAcrossNodeColumns (col comm, p_r) 	Hji, k x (n/p), see allGatherCost
+//	line 7 			reduceScatterAcrossNodeRows (row comm, p_c) Vij, (m/p_r) x k, see reduceScatterCost
+//	line 11 		allGatherAcrossNodeRows (row comm, p_c) 	Wij, (m/p) x k
+//	line 13 		reduceScatterAcrossNodeColumns (col comm, p_r) 	Yij, k x (n/p_c)
+//
+// -objective kl & beta have the same all-gathers & reduce-scatters, but a second
+// reduce-scatter each in place of the all-reduces, or for KL all-reduces of k words
+// (see beta.go).
+// Block sizes are the largest ones in a ragged layout (see partition.go)
+func estimateComm(cfg Config) GridPlan {
+	m, n, k, p := cfg.M, cfg.N, cfg.K, cfg.NumNodes
+	pr, pc := cfg.NodeRows, cfg.NodeCols
+	largeW := blockSizes(m, pr)[0]
+	largeH := blockSizes(n, pc)[0]
+	smallW := blockSizes(largeW, pc)[0]
+	smallH := blockSizes(largeH, pr)[0]
+
+	allReduceAlgo, allGatherAlgo, reduceScatterAlgo := cfg.collectiveAlgos()
+	reduceMsgs, reduceWords := allReduceCost(allReduceAlgo, k*k, p)
+	gatherHMsgs, gatherHWords := allGatherCost(allGatherAlgo, k*smallH, pr)
+	gatherWMsgs, gatherWWords := allGatherCost(allGatherAlgo, smallW*k, pc)
+	scatterWMsgs, scatterWWords := reduceScatterCost(reduceScatterAlgo, largeW*k, pc)
+	scatterHMsgs, scatterHWords := reduceScatterCost(reduceScatterAlgo, k*largeH, pr)
+	if cfg.Objective != objectiveFrobenius {
+		if cfg.betaDivergence() == 1 {
+			// d) & i): sums of k words
+			reduceMsgs, reduceWords = allReduceCost(allReduceAlgo, k, p)
+		} else {
+			// c) & h) twice, no all-reduces
+			scatterWMsgs, scatterWWords = 2*scatterWMsgs, 2*scatterWWords
+			scatterHMsgs, scatterHWords = 2*scatterHMsgs, 2*scatterHWords
+			reduceMsgs, reduceWords = 0, 0
+		}
+	}
+	words := 2*reduceWords + // 4) & 10)
+		gatherHWords + // 5)
+		scatterWWords + // 7)
+		gatherWWords + // 11)
+		scatterHWords // 13)
+
+	return GridPlan{
+		NodeRows: pr,
+		NodeCols: pc,
+		Words:    words,
+		Messages: 2*reduceMsgs + gatherHMsgs + scatterWMsgs + gatherWMsgs + scatterHMsgs,
+	}
+}
+
+// planGrids - valid grids for cfg's p nodes, best (least communication) first
+// Ties are broken by how close p_r/p_c is to m/n
+func planGrids(cfg Config) []GridPlan {
+	m, n := cfg.M, cfg.N
+	var plans []GridPlan
+	for _, g := range gridFactorizations(cfg.NumNodes) {
+		if gridFits(m, n, g[0], g[1]) {
+			cfg.NodeRows, cfg.NodeCols = g[0], g[1]
+			plans = append(plans, estimateComm(cfg))
+		}
+	}
+
+	aspect := func(plan GridPlan) float64 {
+		return math.Abs(math.Log(float64(plan.NodeRows)/float64(plan.NodeCols)) - math.Log(float64(m)/float64(n)))
+	}
+	sort.SliceStable(plans, func(a, b int) bool {
+		if plans[a].Words != plans[b].Words {
+			return plans[a].Words < plans[b].Words
+		}
+		if plans[a].Messages != plans[b].Messages {
+			return plans[a].Messages < plans[b].Messages
+		}
+		return aspect(plans[a]) < aspect(plans[b])
+	})
+	return plans
+}
+
+// printPlans - ranking for the dry-run mode
+func printPlans(w io.Writer, cfg Config, plans []GridPlan) {
+	m, n, k, p := cfg.M, cfg.N, cfg.K, cfg.NumNodes
+	allReduceAlgo, _, _ := cfg.collectiveAlgos()
+	fmt.Fprintf(w, "Grid plans for m = %d, n = %d, k = %d, p = %d (m/n = %.3g), all-reduce %s\n",
+		m, n, k, p, float64(m)/float64(n), pickAllReduce(allReduceAlgo, k*k, p))
+	if len(plans) == 0 {
+		fmt.Fprintln(w, "  no grid fits - need m/p_r >= p_c and n/p_c >= p_r")
+		return
+	}
+	fmt.Fprintf(w, "%5s %6s %6s %10s %14s %10s\n", "rank", "p_r", "p_c", "p_r/p_c", "words/iter", "msgs/iter")
+	for i, plan := range plans {
+		fmt.Fprintf(w, "%5d %6d %6d %10.3g %14d %10d\n", i+1, plan.NodeRows, plan.NodeCols,
+			float64(plan.NodeRows)/float64(plan.NodeCols), plan.Words, plan.Messages)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// desComm - messages & words of one iteration of the DES program, the busiest node
+// of each collective added up the way estimateComm adds up its costs
+func desComm() (msgs, words int) {
+	programs := make([][]desStep, numNodes)
+	for id := range programs {
+		_, programs[id] = desProgram(id)
+	}
+	for s, step := range programs[0] {
+		if step.ops == nil || step.phase == phaseError {
+			continue
+		}
+		stepMsgs, stepWords := 0, 0
+		for id := range programs {
+			sentMsgs, sentWords := 0, 0
+			for o := range programs[id][s].ops {
+				if o.send {
+					sentMsgs++
+					sentWords += o.words()
+				}
+			}
+			stepMsgs, stepWords = max(stepMsgs, sentMsgs), max(stepWords, sentWords)
+		}
+		msgs, words = msgs+stepMsgs, words+stepWords
+	}
+	return msgs, words
+}
+
+// TestPlannerMatchesRun - on grids that divide A evenly, estimateComm counts what the
+// run sends, for every objective & with -reproducible
+func TestPlannerMatchesRun(t *testing.T) {
+	for _, reproducible := range []bool{false, true} {
+		for _, objective := range objectives {
+			for _, g := range [][2]int{{1, 6}, {2, 3}, {3, 2}, {6, 1}} {
+				cfg := defaultConfig()
+				cfg.M, cfg.N, cfg.K = 48, 36, 8
+				cfg.NumNodes, cfg.NodeRows, cfg.NodeCols = 6, g[0], g[1]
+				cfg.Objective, cfg.BetaDiv, cfg.Reproducible = objective, 0.5, reproducible
+				if err := cfg.validate(); err != nil {
+					t.Fatal(err)
+				}
+				applyConfig(cfg)
+				name := fmt.Sprintf("%s %d x %d, reproducible %t", objective, g[0], g[1], reproducible)
+
+				plan := estimateComm(cfg)
+				if msgs, words := desComm(); plan.Messages != msgs || plan.Words != words {
+					t.Errorf("%s: planned %d messages & %d words, the run sends %d & %d",
+						name, plan.Messages, plan.Words, msgs, words)
+				}
+			}
+		}
+	}
+}
+
+// TestPlannerReproducible - with -reproducible the grids are ranked by the naive
+// collectives the run uses, whatever -allreduce & -reducescatter say
+func TestPlannerReproducible(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.M, cfg.N, cfg.K, cfg.NumNodes = 4096, 1024, 64, 16
+	naive := cfg
+	naive.AllReduce, naive.ReduceScatter = allReduceNaive, reduceScatterNaive
+	reproducible := cfg
+	reproducible.Reproducible = true
+
+	if got, want := planGrids(reproducible), planGrids(naive); !slices.Equal(got, want) {
+		t.Errorf("-reproducible plans\n%v\nwant the naive collectives'\n%v", got, want)
+	}
+	if slices.Equal(planGrids(cfg), planGrids(naive)) {
+		t.Errorf("the %s & %s collectives plan the same as the naive ones, the test doesn't tell them apart",
+			cfg.AllReduce, cfg.ReduceScatter)
+	}
+}
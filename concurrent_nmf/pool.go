@@ -0,0 +1,79 @@
+package main
+
+import (
+	"math/bits"
+	"runtime"
+	"sync"
+	"weak"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Buffer pool
+// Message buffers - copies made on send (copy mode, see communicator.go), the
+// pieces collectives pack for each send, decoded TCP payloads - & parallelNMF's
+// products come from here, in power of 2 size classes. Whoever owns a buffer once
+// it's done with it (the receiver, for a message) hands it back with putBuffer.
+var bufferPools [bits.UintSize]sync.Pool
+
+// lent - buffers getBuffer handed out & nobody gave back yet, by their first element
+// Weak, so a buffer that's dropped instead of given back can still be collected
+// (its cleanup takes it out of here).
+var lent sync.Map // weak.Pointer[float64] -> struct{}
+
+// getBuffer - n float64s, not zeroed
+func getBuffer(n int) []float64 {
+	if n == 0 {
+		return nil
+	}
+	// at least 2, so a buffer is never in the tiny allocator (no cleanups there)
+	class := max(1, bits.Len(uint(n-1)))
+	if p, ok := bufferPools[class].Get().(*[]float64); ok {
+		lent.Store(weak.Make(&(*p)[0]), struct{}{})
+		return (*p)[:n]
+	}
+	data := make([]float64, n, 1<<class)
+	key := weak.Make(&data[0])
+	runtime.AddCleanup(&data[0], func(key weak.Pointer[float64]) { lent.Delete(key) }, key)
+	lent.Store(key, struct{}{})
+	return data
+}
+
+// putBuffer - give data back to the pool
+// Ignored unless getBuffer handed it out & it wasn't given back already, so a slice
+// of someone else's (a matrix from the user, a view in share mode) never gets in.
+func putBuffer(data []float64) {
+	if cap(data) == 0 {
+		return
+	}
+	data = data[:cap(data)]
+	if _, ok := lent.LoadAndDelete(weak.Make(&data[0])); !ok {
+		return
+	}
+	bufferPools[bits.Len(uint(len(data)-1))].Put(&data)
+}
+
+// pooledDense - r x c matrix in a pooled buffer, not zeroed
+func pooledDense(r, c int) *mat.Dense {
+	return mat.NewDense(r, c, getBuffer(r*c))
+}
+
+// pooledCopy - copy of x in a pooled buffer
+func pooledCopy(x *mat.Dense) *mat.Dense {
+	if x.IsEmpty() {
+		return &mat.Dense{}
+	}
+	r, c := x.Dims()
+	dst := pooledDense(r, c)
+	dst.Copy(x)
+	return dst
+}
+
+// release - give the matrices' buffers back to the pool
+func release(xs ...*mat.Dense) {
+	for _, x := range xs {
+		if !x.IsEmpty() {
+			putBuffer(x.RawMatrix().Data)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"math/bits"
+	"testing"
+)
+
+// TestPutBuffer - only buffers getBuffer lent out go back in the pool, & only once
+func TestPutBuffer(t *testing.T) {
+	for _, n := range []int{1, 3, 4, 100} {
+		foreign := make([]float64, n, 1<<max(1, bits.Len(uint(n-1))))
+		putBuffer(foreign)
+		if got := getBuffer(n); &got[:1][0] == &foreign[0] {
+			t.Errorf("n = %d: getBuffer handed out a slice it never lent", n)
+		}
+
+		b := getBuffer(n)
+		if len(b) != n {
+			t.Fatalf("getBuffer(%d) has %d elements", n, len(b))
+		}
+		putBuffer(b)
+		putBuffer(b)
+		x, y := getBuffer(n), getBuffer(n)
+		if &x[0] == &y[0] {
+			t.Errorf("n = %d: a buffer given back twice was lent twice", n)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import "iter"
+
+// Reduce-scatter algorithms, for p members each with w words split into p blocks
+//
+//	naive 		- everyone sends all w words to everyone, reduces all of it,
+//				  then keeps its own block 							p-1 messages, (p-1)w words
+//	pairwise 	- step s, send block rank+s to rank+s & get my block
+//				  from rank-s 										p-1 messages, ~w words
+//	rh 			- recursive halving, send the half I'm not keeping to
+//				  partner rank ^ mask 								log p messages, ~w words
+//
+// pairwise & rh only ever send a member the blocks it ends up owning, like MPI_Reduce_scatter
+const (
+	reduceScatterNaive      = "naive"
+	reduceScatterPairwise   = "pairwise"
+	reduceScatterRecHalving = "rh"
+	reduceScatterAuto       = "auto"
+)
+
+var reduceScatterAlgos = []string{reduceScatterNaive, reduceScatterPairwise, reduceScatterRecHalving, reduceScatterAuto}
+
+// At or above this many bytes, pairwise's fewer total words win (MPICH's default)
+const reduceScatterLongMsg = 524288
+
+// Algorithm used by Node.reduceScatterAcrossNodeRows/Columns, set from the Config by applyConfig
+var reduceScatterAlgo = reduceScatterAuto
+
+// pickReduceScatter - resolve auto by the size of each member's whole contribution
+func pickReduceScatter(algo string, totalWords, size int) string {
+	if algo != reduceScatterAuto {
+		return algo
+	}
+	if totalWords*8 < reduceScatterLongMsg {
+		return reduceScatterRecHalving
+	}
+	return reduceScatterPairwise
+}
+
+// reduceScatterv - data holds my contribution to every member, block i (counts[i] words)
+// for rank i, in rank order. Returns the sum over all members of my block.
+// data gets used as scratch space.
+func (c *Communicator) reduceScatterv(data []float64, counts []int, algo string) []float64 {
+	size, rank := c.Size(), c.Rank()
+	offsets := countOffsets(counts)
+
+	if size > 1 {
+		algo = pickReduceScatter(algo, len(data), size)
+		if algo == reduceScatterNaive {
+			// naive has no block-wise version, the Node collectives keep their own
+			parts := c.exchange(vecOf(data))
+			for i := range parts {
+				if i != rank {
+					addInto(data, vecData(parts[i]))
+				}
+			}
+			c.recycle(parts)
+		} else {
+			c.run(reduceScattervOps(algo, rank, counts), data, tagReduceScatter)
+		}
+	}
+	return append([]float64(nil), data[offsets[rank]:offsets[rank+1]]...)
+}
+
+// reduceScattervOps - my schedule for a reduce-scatter into blocks of counts[i] words (see schedule.go)
+func reduceScattervOps(algo string, rank int, counts []int) iter.Seq[op] {
+	size := len(counts)
+	offsets := countOffsets(counts)
+	blocks := func(lo, hi int) span {
+		return span{offsets[lo], offsets[hi]}
+	}
+
+	switch pickReduceScatter(algo, offsets[size], size) {
+	case reduceScatterPairwise:
+		return pairwiseReduceScatterOps(rank, size, blocks)
+	case reduceScatterRecHalving:
+		return recHalvingReduceScatterOps(rank, size, blocks)
+	default:
+		all := make([]int, size)
+		for i := range all {
+			all[i] = offsets[size]
+		}
+		return exchangeOps(rank, all)
+	}
+}
+
+// pairwiseReduceScatterOps - step s: send block rank+s to its owner, add in my
+// block from rank-s
+func pairwiseReduceScatterOps(rank, size int, blocks func(lo, hi int) span) iter.Seq[op] {
+	return func(yield func(op) bool) {
+		for s := 1; s < size; s++ {
+			dest, src := (rank+s)%size, (rank-s+size)%size
+			if !yield(sendOp(dest, blocks(dest, dest+1))) || !yield(recvAddOp(src, blocks(rank, rank+1))) {
+				return
+			}
+		}
+	}
+}
+
+// recHalvingReduceScatterOps - fold to a power of 2 (see fold), then halve
+// Folded member r (< rem) owns the blocks of real ranks 2r & 2r+1, the rest own
+// r+rem, so every window of folded members is a contiguous run of blocks.
+func recHalvingReduceScatterOps(rank, size int, blocks func(lo, hi int) span) iter.Seq[op] {
+	newRank, pof2, rem := fold(rank, size)
+	firstBlock := func(r int) int {
+		if r < rem {
+			return 2 * r
+		}
+		return r + rem
+	}
+	window := func(lo, hi int) span {
+		return blocks(firstBlock(lo), firstBlock(hi))
+	}
+
+	return func(yield func(op) bool) {
+		if o, ok := foldOp(rank, newRank, rem, blocks(0, size)); ok && !yield(o) {
+			return
+		}
+		if newRank >= 0 {
+			lo, hi := 0, pof2
+			for mask := pof2 / 2; mask > 0; mask >>= 1 {
+				partner := foldedRank(newRank^mask, rem)
+				mid := (lo + hi) / 2
+				send, keep := window(mid, hi), window(lo, mid)
+				if newRank&mask == 0 {
+					hi = mid
+				} else {
+					send, keep = keep, send
+					lo = mid
+				}
+				if !yield(sendOp(partner, send)) || !yield(recvAddOp(partner, keep)) {
+					return
+				}
+			}
+		}
+		// give the members that sat out their block
+		if o, ok := unfoldOp(rank, newRank, rem, func(r int) span { return blocks(r, r+1) }); ok {
+			yield(o)
+		}
+	}
+}
+
+// reduceScatterCost - messages & words the busiest member sends, scattering w words
+func reduceScatterCost(algo string, totalWords, size int) (msgs, sent int) {
+	if size == 1 {
+		return 0, 0
+	}
+	block := blockSizes(totalWords, size)[0]
+	switch pickReduceScatter(algo, totalWords, size) {
+	case reduceScatterNaive:
+		return size - 1, (size - 1) * totalWords
+	case reduceScatterPairwise:
+		return size - 1, (size - 1) * block
+	default: // reduceScatterRecHalving
+		pof2, logP := powerOf2Below(size)
+		halving := totalWords - totalWords/pof2
+		if size > pof2 {
+			// evens of folded pairs send everything once, odds halve then send a block back
+			return logP + 1, max(totalWords, halving+block)
+		}
+		return logP, halving
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import "iter"
+
+// Collective schedules
+// Each collective algorithm is written once, as the sequence of sends & receives
+// one member does (its schedule). Two engines run schedules:
+//	goroutines 	- Communicator.run, real messages carrying real data
+//	des 		- the discrete-event engine (des.go), only the timing
+// so both engines always run exactly the same message pattern.
+// Schedules are generated as they're used - a ring over 10k members is 20k ops
+// per member, too many to keep around for every member at once.
+
+// span - elements lo:hi of the collective's data buffer
+type span struct {
+	lo, hi int
+}
+
+// op - one send or receive in a member's schedule
+// A send carries spans of the data buffer (concatenated), a receive puts the
+// message into spans (copied, or added when add is set).
+type op struct {
+	send  bool
+	peer  int // rank in the communicator
+	spans []span
+	add   bool
+}
+
+func (o op) words() int {
+	words := 0
+	for _, s := range o.spans {
+		words += s.hi - s.lo
+	}
+	return words
+}
+
+func sendOp(peer int, spans ...span) op {
+	return op{send: true, peer: peer, spans: spans}
+}
+
+func recvOp(peer int, spans ...span) op {
+	return op{peer: peer, spans: spans}
+}
+
+func recvAddOp(peer int, spans ...span) op {
+	return op{peer: peer, spans: spans, add: true}
+}
+
+// run - carry out a schedule on data with real messages, all tagged with tag
+func (c *Communicator) run(ops iter.Seq[op], data []float64, tag int) {
+	for o := range ops {
+		if o.send {
+			// packed into a buffer nobody else has, so it can go as is in any send mode
+			out, off := getBuffer(o.words()), 0
+			for _, s := range o.spans {
+				off += copy(out[off:], data[s.lo:s.hi])
+			}
+			c.handOff(o.peer, tag, vec(out))
+			continue
+		}
+
+		msg := vecData(c.recvFrom(o.peer, tag))
+		in := msg
+		for _, s := range o.spans {
+			if o.add {
+				addInto(data[s.lo:s.hi], in)
+			} else {
+				copy(data[s.lo:s.hi], in)
+			}
+			in = in[s.hi-s.lo:]
+		}
+		// it's all in data now & the message was handed off to me
+		putBuffer(msg)
+	}
+}
+
+// exchangeOps - the message pattern of Communicator.exchange (the naive collectives)
+// Send my words to every other member, then receive theirs, both in rank order.
+// Only used for timing.
+func exchangeOps(rank int, counts []int) iter.Seq[op] {
+	return func(yield func(op) bool) {
+		for peer := range counts {
+			if peer != rank && !yield(sendOp(peer, span{0, counts[rank]})) {
+				return
+			}
+		}
+		for peer := range counts {
+			if peer != rank && !yield(recvOp(peer, span{0, counts[peer]})) {
+				return
+			}
+		}
+	}
+}
+
+// countOffsets - prefix sums of counts, len = len(counts)+1
+func countOffsets(counts []int) []int {
+	offsets := make([]int, len(counts)+1)
+	for i, cnt := range counts {
+		offsets[i+1] = offsets[i] + cnt
+	}
+	return offsets
+}
+
+// powerOf2Below - largest power of 2 <= size, & its log
+func powerOf2Below(size int) (pof2, logP int) {
+	pof2 = 1
+	for pof2*2 <= size {
+		pof2 *= 2
+		logP++
+	}
+	return pof2, logP
+}
+
+// Folding to a power of 2 (like MPICH): the first 2*rem members pair up & the
+// evens hand everything to the odds, leaving pof2 members. Once those are done,
+// the evens get their part of the result back.
+
+// fold - my rank among the pof2 members left (-1 if I sat out), pof2 & rem
+func fold(rank, size int) (newRank, pof2, rem int) {
+	pof2, _ = powerOf2Below(size)
+	rem = size - pof2
+	switch {
+	case rank < 2*rem && rank%2 == 0:
+		return -1, pof2, rem
+	case rank < 2*rem:
+		return rank / 2, pof2, rem
+	default:
+		return rank - rem, pof2, rem
+	}
+}
+
+// foldOp - my part in folding all (if any)
+func foldOp(rank, newRank, rem int, all span) (op, bool) {
+	switch {
+	case newRank < 0:
+		return sendOp(rank+1, all), true
+	case rank < 2*rem:
+		return recvAddOp(rank-1, all), true
+	}
+	return op{}, false
+}
+
+// unfoldOp - my part in giving the members that sat out their part of the result
+// (if any), sitting-out member r gets block(r)
+func unfoldOp(rank, newRank, rem int, block func(r int) span) (op, bool) {
+	switch {
+	case newRank < 0:
+		return recvOp(rank+1, block(rank)), true
+	case rank < 2*rem:
+		return sendOp(rank-1, block(rank-1)), true
+	}
+	return op{}, false
+}
+
+// foldedRank - real rank of the member with rank r among the pof2 left after folding
+func foldedRank(r, rem int) int {
+	if r < rem {
+		return 2*r + 1
+	}
+	return r + rem
+}
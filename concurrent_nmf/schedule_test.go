@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"iter"
+	"testing"
+)
+
+// replay - carry out every member's schedule on its own data, with in-memory
+// mailboxes instead of a Communicator: each member in turn runs until it has to wait
+// for a message that hasn't been sent yet. Fails on a message that doesn't fit the
+// receive's spans, on a deadlock & on messages nobody received. Returns the messages
+// each member sent.
+func replay(schedules []iter.Seq[op], data [][]float64) ([]int, error) {
+	size := len(schedules)
+	type mailbox struct{ src, dest int }
+	boxes := make(map[mailbox][][]float64)
+	next, stops := make([]func() (op, bool), size), make([]func(), size)
+	for r, ops := range schedules {
+		next[r], stops[r] = iter.Pull(ops)
+		defer stops[r]()
+	}
+	waiting := make([]*op, size) // receive a member is stuck on
+	done, sent := make([]bool, size), make([]int, size)
+
+	for finished := 0; finished < size; {
+		progress := false
+		for r := range schedules {
+			for !done[r] {
+				o, ok := op{}, true
+				if waiting[r] != nil {
+					o, waiting[r] = *waiting[r], nil
+				} else if o, ok = next[r](); !ok {
+					done[r] = true
+					finished++
+					progress = true
+					break
+				}
+
+				if o.send {
+					msg := []float64{}
+					for _, s := range o.spans {
+						msg = append(msg, data[r][s.lo:s.hi]...)
+					}
+					key := mailbox{r, o.peer}
+					boxes[key] = append(boxes[key], msg)
+					sent[r]++
+					progress = true
+					continue
+				}
+				key := mailbox{o.peer, r}
+				if len(boxes[key]) == 0 {
+					waiting[r] = &o
+					break
+				}
+				msg := boxes[key][0]
+				boxes[key] = boxes[key][1:]
+				if len(msg) != o.words() {
+					return sent, fmt.Errorf("rank %d got %d words from rank %d, its receive has room for %d", r, len(msg), o.peer, o.words())
+				}
+				for _, s := range o.spans {
+					if o.add {
+						addInto(data[r][s.lo:s.hi], msg)
+					} else {
+						copy(data[r][s.lo:s.hi], msg)
+					}
+					msg = msg[s.hi-s.lo:]
+				}
+				progress = true
+			}
+		}
+		if !progress {
+			var stuck []int
+			for r := range done {
+				if !done[r] {
+					stuck = append(stuck, r)
+				}
+			}
+			return sent, fmt.Errorf("deadlock, ranks %v wait for messages nobody sends", stuck)
+		}
+	}
+	for key, msgs := range boxes {
+		if len(msgs) > 0 {
+			return sent, fmt.Errorf("%d messages from rank %d to rank %d never received", len(msgs), key.src, key.dest)
+		}
+	}
+	return sent, nil
+}
+
+func maxOf(counts []int) int {
+	most := 0
+	for _, c := range counts {
+		most = max(most, c)
+	}
+	return most
+}
+
+func TestAllReduceSchedules(t *testing.T) {
+	for _, algo := range allReduceAlgos {
+		for size := 1; size <= 9; size++ {
+			for _, words := range []int{3, 40, 400} {
+				schedules, data := make([]iter.Seq[op], size), make([][]float64, size)
+				want := make([]float64, words)
+				for r := range schedules {
+					schedules[r] = allReduceOps(algo, r, size, words)
+					data[r] = make([]float64, words)
+					for j := range data[r] {
+						data[r][j] = float64(r*1000 + j)
+						want[j] += data[r][j]
+					}
+				}
+				sent, err := replay(schedules, data)
+				name := fmt.Sprintf("%s, %d members, %d words", algo, size, words)
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+				if pickAllReduce(algo, words, size) != allReduceNaive {
+					// naive's schedule is only the timing of exchange, see exchangeOps
+					for r := range data {
+						for j, v := range data[r] {
+							if v != want[j] {
+								t.Errorf("%s: rank %d has %g at %d, want %g", name, r, v, j, want[j])
+								break
+							}
+						}
+					}
+				}
+				if msgs, _ := allReduceCost(algo, words, size); msgs != maxOf(sent) {
+					t.Errorf("%s: busiest member sent %d messages, allReduceCost says %d", name, maxOf(sent), msgs)
+				}
+			}
+		}
+	}
+}
+
+func TestAllGatherSchedules(t *testing.T) {
+	for _, algo := range allGatherAlgos {
+		for size := 1; size <= 9; size++ {
+			for _, scale := range []int{1, 100} {
+				counts := make([]int, size)
+				for r := range counts {
+					counts[r] = ((r*5)%3 + 1) * scale
+				}
+				offsets := countOffsets(counts)
+				schedules, data := make([]iter.Seq[op], size), make([][]float64, size)
+				for r := range schedules {
+					schedules[r] = allGathervOps(algo, r, counts)
+					data[r] = make([]float64, offsets[size])
+					for j := offsets[r]; j < offsets[r+1]; j++ {
+						data[r][j] = float64(r*1000 + j)
+					}
+				}
+				sent, err := replay(schedules, data)
+				name := fmt.Sprintf("%s, %d members, scale %d", algo, size, scale)
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+				if pickAllGather(algo, offsets[size], size) != allGatherNaive {
+					for r := range data {
+						for from := range counts {
+							for j := offsets[from]; j < offsets[from+1]; j++ {
+								if data[r][j] != float64(from*1000+j) {
+									t.Errorf("%s: rank %d got the wrong block from rank %d", name, r, from)
+									break
+								}
+							}
+						}
+					}
+				}
+				if msgs, _ := allGatherCost(algo, counts[0], size); msgs != maxOf(sent) {
+					t.Errorf("%s: busiest member sent %d messages, allGatherCost says %d", name, maxOf(sent), msgs)
+				}
+			}
+		}
+	}
+}
+
+func TestReduceScatterSchedules(t *testing.T) {
+	for _, algo := range reduceScatterAlgos {
+		for size := 1; size <= 9; size++ {
+			for _, scale := range []int{1, 100} {
+				counts := make([]int, size)
+				for r := range counts {
+					counts[r] = ((r*7)%4 + 1) * scale
+				}
+				offsets := countOffsets(counts)
+				schedules, data := make([]iter.Seq[op], size), make([][]float64, size)
+				want := make([]float64, offsets[size])
+				for r := range schedules {
+					schedules[r] = reduceScattervOps(algo, r, counts)
+					data[r] = make([]float64, offsets[size])
+					for j := range data[r] {
+						data[r][j] = float64(r*1000 + j)
+						want[j] += data[r][j]
+					}
+				}
+				sent, err := replay(schedules, data)
+				name := fmt.Sprintf("%s, %d members, scale %d", algo, size, scale)
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+				if pickReduceScatter(algo, offsets[size], size) != reduceScatterNaive {
+					for r := range data {
+						for j := offsets[r]; j < offsets[r+1]; j++ {
+							if data[r][j] != want[j] {
+								t.Errorf("%s: rank %d has %g at %d, want %g", name, r, data[r][j], j, want[j])
+								break
+							}
+						}
+					}
+				}
+				if msgs, _ := reduceScatterCost(algo, offsets[size], size); msgs != maxOf(sent) {
+					t.Errorf("%s: busiest member sent %d messages, reduceScatterCost says %d", name, maxOf(sent), msgs)
+				}
+			}
+		}
+	}
+}
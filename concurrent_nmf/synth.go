@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+
+	"569-final-project/nmfcore"
+
+	"gonum.org/v1/gonum/mat"
+	"gonum.org/v1/gonum/stat/distuv"
+)
+
+// Input data (-data)
+//	ramp 		- A[i][j] = i*n + j, the old test matrix (rank 2, nothing to recover)
+//	synthetic 	- A = Wt Ht + noise from planted nonnegative factors Wt (m x r) & Ht (r x n)
+//	file 		- A from the file -input (see input.go)
+// Every entry of a planted factor is sqrt(c) s + sqrt(1-c) e, s shared by the row of
+// Wt (column of Ht) & e its own, both uniform on [0, 1), so any two components have
+// correlation c (-correlation). Then it's 0 with probability -sparsity. Noise is
+//	none 		- A = Wt Ht
+//	gaussian 	- A = max(0, Wt Ht + N(0, s^2)), clipped since A has to be nonnegative
+//	poisson 	- A = q Poisson(Wt Ht / q), q = s^2 / mu, so the variance is Wt Ht q
+// with s = -noiselevel x mu, mu the expected entry of Wt Ht. Like the init (see
+// nmfcore.RNG), rows of Wt, columns of Ht & entries of the noise have their own random
+// streams, off -dataseed, so a node makes its block of A without the rest of A
+// (see makeAPiece) & every grid factorizes the same A.
+//
+// With synthetic data the run ends by scoring W & H against the planted factors, see
+// factorMatch. -planted dir also saves them to dir/W.txt & dir/H.txt (see
+// nmfcore.WriteMatrix), which -init file can read when the planted rank is k.
+const (
+	dataRamp      = "ramp"
+	dataSynthetic = "synthetic"
+	dataFile      = "file"
+)
+
+var dataKinds = []string{dataRamp, dataSynthetic, dataFile}
+
+const (
+	noiseNone     = "none"
+	noiseGaussian = "gaussian"
+	noisePoisson  = "poisson"
+)
+
+var noiseModels = []string{noiseNone, noiseGaussian, noisePoisson}
+
+// Data settings, set from the Config by applyConfig
+var dataKind = dataRamp
+var dataSeed int64
+var plantedRank int
+var sparsity, correlation float64
+var noiseModel = noiseNone
+var noiseLevel float64
+var plantedDir string
+
+// Random streams of the data, after the init's (see nmfcore.RNG), in case -dataseed = -seed
+const (
+	streamPlantedW = nmfcore.StreamNext + iota // index = row of Wt
+	streamPlantedH                         // index = column of Ht
+	streamNoise                            // index = i*n + j, entry of A
+)
+
+// dataRNG - a stream's source for index, like nmfcore.RNG but off -dataseed
+func dataRNG(stream, index int) *rand.PCG {
+	return rand.NewPCG(uint64(dataSeed), uint64(stream)<<40|uint64(index))
+}
+
+// plantedRows - rows x plantedRank, row r of the planted factor from stream's index first+r
+func plantedRows(stream, first, rows int) *mat.Dense {
+	X := mat.NewDense(rows, plantedRank, nil)
+	a, b := math.Sqrt(correlation), math.Sqrt(1-correlation)
+	for r := 0; r < rows; r++ {
+		rng := rand.New(dataRNG(stream, first+r))
+		shared := rng.Float64()
+		row := X.RawRowView(r)
+		for j := range row {
+			row[j] = a*shared + b*rng.Float64()
+			if rng.Float64() < sparsity {
+				row[j] = 0
+			}
+		}
+	}
+	return X
+}
+
+// plantedW - rows rowStart.. of Wt
+func plantedW(rowStart, rows int) *mat.Dense {
+	return plantedRows(streamPlantedW, rowStart, rows)
+}
+
+// plantedH - columns colStart.. of Ht
+func plantedH(colStart, cols int) *mat.Dense {
+	return mat.DenseCopyOf(plantedRows(streamPlantedH, colStart, cols).T())
+}
+
+// plantedMean - expected entry of Wt Ht: r x E[w] x E[h]
+func plantedMean() float64 {
+	e := (1 - sparsity) * (math.Sqrt(correlation) + math.Sqrt(1-correlation)) / 2
+	return float64(plantedRank) * e * e
+}
+
+// synthPiece - the rows x cols block of the synthetic A at (rowStart, colStart)
+func synthPiece(rowStart, rows, colStart, cols int) *mat.Dense {
+	A := &mat.Dense{}
+	A.Mul(plantedW(rowStart, rows), plantedH(colStart, cols))
+	if noiseModel == noiseNone {
+		return A
+	}
+
+	s := noiseLevel * plantedMean()
+	q := s * s / plantedMean()
+	for i := 0; i < rows; i++ {
+		row := A.RawRowView(i)
+		for j, x := range row {
+			src := dataRNG(streamNoise, (rowStart+i)*n+colStart+j)
+			switch {
+			case noiseModel == noiseGaussian:
+				row[j] = math.Max(0, x+s*rand.New(src).NormFloat64())
+			case x > 0 && q > 0:
+				row[j] = q * distuv.Poisson{Lambda: x / q, Src: src}.Rand()
+			}
+		}
+	}
+	return A
+}
+
+// savePlanted - write Wt & Ht to dir/W.txt & dir/H.txt
+func savePlanted(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	header := fmt.Sprintf("planted rank %d, sparsity %g, correlation %g, data seed %d", plantedRank, sparsity, correlation, dataSeed)
+	if err := nmfcore.WriteMatrix(filepath.Join(dir, "W.txt"), plantedW(0, m), header); err != nil {
+		return err
+	}
+	return nmfcore.WriteMatrix(filepath.Join(dir, "H.txt"), plantedH(0, n), header)
+}
+
+// reportRecovery - how well W & H recover the planted factors
+func reportRecovery(w io.Writer, W, H *mat.Dense) {
+	if sum := mat.Sum(W) + mat.Sum(H); math.IsNaN(sum) || math.IsInf(sum, 0) {
+		fmt.Fprintln(w, "Recovery: W or H isn't finite, nothing to score")
+		return
+	}
+	score, wCos, hCos, matched := factorMatch(plantedW(0, m), plantedH(0, n), W, H)
+	fmt.Fprintf(w, "Recovery: factor match score %.4f, mean cosine W %.4f, H %.4f (%d of %d planted components matched)\n",
+		score, wCos, hCos, matched, plantedRank)
+}
+
+// factorMatch - factor match score of W & H against the true Wt & Ht, after lining up
+// their components (Wt's column & Ht's row r with the column of W & row of H that
+// bestAssignment gives it) so the sum of cos(wt_r, w) x cos(ht_r, h) is largest. Component r scores
+//
+//	(1 - |lt_r - l| / max(lt_r, l)) x cos(wt_r, w) x cos(ht_r, h) 		l = ||w|| ||h||
+//
+// & the score is the mean over Wt's components, 0 for those left over when W has
+// fewer. Also returns the mean cosines of the matched columns of W & rows of H.
+func factorMatch(Wt, Ht, W, H *mat.Dense) (score, wCos, hCos float64, matched int) {
+	_, r := Wt.Dims()
+	_, c := W.Dims()
+	wtNorms, htNorms := componentNorms(Wt, Ht)
+	wNorms, hNorms := componentNorms(W, H)
+	WtW, HtH := &mat.Dense{}, &mat.Dense{}
+	WtW.Mul(Wt.T(), W) // r x c
+	HtH.Mul(Ht, H.T()) // r x c
+
+	cosine := func(dot, a, b float64) float64 {
+		if a == 0 || b == 0 {
+			return 0
+		}
+		return dot / (a * b)
+	}
+	congruence := mat.NewDense(r, c, nil)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			congruence.Set(i, j, cosine(WtW.At(i, j), wtNorms[i], wNorms[j])*cosine(HtH.At(i, j), htNorms[i], hNorms[j]))
+		}
+	}
+
+	for i, j := range bestAssignment(congruence) {
+		if j < 0 {
+			continue
+		}
+		lt, l := wtNorms[i]*htNorms[i], wNorms[j]*hNorms[j]
+		if top := math.Max(lt, l); top > 0 {
+			score += (1 - math.Abs(lt-l)/top) * congruence.At(i, j)
+		}
+		wCos += cosine(WtW.At(i, j), wtNorms[i], wNorms[j])
+		hCos += cosine(HtH.At(i, j), htNorms[i], hNorms[j])
+		matched++
+	}
+	if matched > 0 {
+		wCos, hCos = wCos/float64(matched), hCos/float64(matched)
+	}
+	return score / float64(r), wCos, hCos, matched
+}
+
+// componentNorms - norms of W's columns & H's rows
+func componentNorms(W, H *mat.Dense) ([]float64, []float64) {
+	_, c := W.Dims()
+	wNorms, hNorms := make([]float64, c), make([]float64, c)
+	for j := 0; j < c; j++ {
+		wNorms[j] = mat.Norm(W.ColView(j), 2)
+		hNorms[j] = mat.Norm(H.RowView(j), 2)
+	}
+	return wNorms, hNorms
+}
+
+// bestAssignment - a distinct column for every row of score (or every column a row,
+// if there are fewer columns) with the largest total: assignment[i] = row i's
+// column, -1 for none. Scores have to be finite. Hungarian algorithm (Kuhn-Munkres)
+// with potentials, O(r^2 c).
+func bestAssignment(score *mat.Dense) []int {
+	r, c := score.Dims()
+	if r > c {
+		byCol := bestAssignment(mat.DenseCopyOf(score.T()))
+		assignment := make([]int, r)
+		for i := range assignment {
+			assignment[i] = -1
+		}
+		for j, i := range byCol {
+			assignment[i] = j
+		}
+		return assignment
+	}
+
+	// minimize -score, rows & columns from 1, column 0 is the free end of the path
+	u, v := make([]float64, r+1), make([]float64, c+1)
+	rowOf, way := make([]int, c+1), make([]int, c+1)
+	for i := 1; i <= r; i++ {
+		rowOf[0] = i
+		j0 := 0
+		minv := make([]float64, c+1)
+		used := make([]bool, c+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		for rowOf[j0] != 0 {
+			used[j0] = true
+			i0, delta, j1 := rowOf[j0], math.Inf(1), 0
+			for j := 1; j <= c; j++ {
+				if used[j] {
+					continue
+				}
+				if cur := -score.At(i0-1, j-1) - u[i0] - v[j]; cur < minv[j] {
+					minv[j], way[j] = cur, j0
+				}
+				if minv[j] < delta {
+					delta, j1 = minv[j], j
+				}
+			}
+			for j := 0; j <= c; j++ {
+				if used[j] {
+					u[rowOf[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+		}
+		// flip the augmenting path
+		for j0 != 0 {
+			j1 := way[j0]
+			rowOf[j0] = rowOf[j1]
+			j0 = j1
+		}
+	}
+
+	assignment := make([]int, r)
+	for j := 1; j <= c; j++ {
+		if rowOf[j] != 0 {
+			assignment[rowOf[j]-1] = j - 1
+		}
+	}
+	return assignment
+}
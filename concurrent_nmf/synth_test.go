@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// bruteAssignment - the best total of bestAssignment's problem, trying every assignment
+func bruteAssignment(score *mat.Dense) float64 {
+	r, c := score.Dims()
+	used := make([]bool, c)
+	var best func(i, left int) float64
+	best = func(i, left int) float64 {
+		if i == r || left == 0 {
+			return 0
+		}
+		top := math.Inf(-1)
+		if r-i > left {
+			top = best(i+1, left) // row i gets no column
+		}
+		for j := 0; j < c; j++ {
+			if !used[j] {
+				used[j] = true
+				top = max(top, score.At(i, j)+best(i+1, left-1))
+				used[j] = false
+			}
+		}
+		return top
+	}
+	return best(0, min(r, c))
+}
+
+// TestBestAssignment - distinct columns, min(r, c) of them, with the brute-force best
+// total, square & rectangular
+func TestBestAssignment(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for r := 1; r <= 6; r++ {
+		for c := 1; c <= 6; c++ {
+			for trial := 0; trial < 20; trial++ {
+				score := mat.NewDense(r, c, nil)
+				for i := 0; i < r; i++ {
+					for j := 0; j < c; j++ {
+						// a few ties & negatives too
+						score.Set(i, j, float64(rng.IntN(7)-2)+rng.Float64()*float64(trial%2))
+					}
+				}
+				name := fmt.Sprintf("%d x %d, trial %d", r, c, trial)
+
+				assignment := bestAssignment(score)
+				if len(assignment) != r {
+					t.Fatalf("%s: %d rows assigned, want %d", name, len(assignment), r)
+				}
+				total, assigned, seen := 0.0, 0, make([]bool, c)
+				for i, j := range assignment {
+					if j < 0 {
+						continue
+					}
+					if j >= c || seen[j] {
+						t.Fatalf("%s: column %d given twice or out of range in %v", name, j, assignment)
+					}
+					seen[j] = true
+					total += score.At(i, j)
+					assigned++
+				}
+				if assigned != min(r, c) {
+					t.Fatalf("%s: %d rows assigned in %v, want %d", name, assigned, assignment, min(r, c))
+				}
+				if want := bruteAssignment(score); math.Abs(total-want) > 1e-9 {
+					t.Fatalf("%s: total %g, brute force %g (%v)", name, total, want, assignment)
+				}
+			}
+		}
+	}
+}
+
+// TestFactorMatch - W & H that are the planted factors with their components permuted
+// & scaled (W by d, H by 1/d) score 1, extra components in W don't count against it,
+// missing ones score 0 & other factors score less
+func TestFactorMatch(t *testing.T) {
+	const rows, cols, r = 17, 13, 4
+	rng := rand.New(rand.NewPCG(3, 4))
+	random := func(rr, cc int) *mat.Dense {
+		X := mat.NewDense(rr, cc, nil)
+		for i := 0; i < rr; i++ {
+			for j := 0; j < cc; j++ {
+				if rng.Float64() < 0.6 {
+					X.Set(i, j, rng.Float64())
+				}
+			}
+		}
+		return X
+	}
+	Wt, Ht := random(rows, r), random(r, cols)
+
+	// component l of W & H is the planted perm[l], plus extra random ones
+	recovered := func(perm []int, extra int) (*mat.Dense, *mat.Dense) {
+		c := len(perm) + extra
+		W, H := random(rows, c), random(c, cols)
+		for l, p := range perm {
+			d := 0.5 + 3*rng.Float64()
+			for i := 0; i < rows; i++ {
+				W.Set(i, l, d*Wt.At(i, p))
+			}
+			for j := 0; j < cols; j++ {
+				H.Set(l, j, Ht.At(p, j)/d)
+			}
+		}
+		return W, H
+	}
+
+	check := func(name string, got, want float64) {
+		t.Helper()
+		if math.Abs(got-want) > 1e-12 {
+			t.Errorf("%s: %.15g, want %g", name, got, want)
+		}
+	}
+	for _, extra := range []int{0, 2} {
+		W, H := recovered([]int{2, 0, 3, 1}, extra)
+		score, wCos, hCos, matched := factorMatch(Wt, Ht, W, H)
+		name := fmt.Sprintf("permuted, %d extra", extra)
+		check(name+" score", score, 1)
+		check(name+" W cosine", wCos, 1)
+		check(name+" H cosine", hCos, 1)
+		if matched != r {
+			t.Errorf("%s: %d matched, want %d", name, matched, r)
+		}
+	}
+
+	// 2 of the 4 planted components: the other 2 score 0
+	W, H := recovered([]int{3, 1}, 0)
+	score, wCos, hCos, matched := factorMatch(Wt, Ht, W, H)
+	check("half score", score, 0.5)
+	check("half W cosine", wCos, 1)
+	check("half H cosine", hCos, 1)
+	if matched != 2 {
+		t.Errorf("half: %d matched, want 2", matched)
+	}
+
+	// scaled by 2 without scaling back: the cosines are still 1 but the scale is off
+	W, H = recovered([]int{0, 1, 2, 3}, 0)
+	H.Scale(2, H)
+	score, wCos, hCos, _ = factorMatch(Wt, Ht, W, H)
+	check("scaled score", score, 0.5)
+	check("scaled W cosine", wCos, 1)
+	check("scaled H cosine", hCos, 1)
+
+	W, H = random(rows, r), random(r, cols)
+	if score, _, _, _ := factorMatch(Wt, Ht, W, H); !(score < 0.9) {
+		t.Errorf("unrelated factors score %g", score)
+	}
+}
+
+// TestSynthPiece - any block of the synthetic A is that block of the whole A, for
+// every noise model
+func TestSynthPiece(t *testing.T) {
+	savedRank, savedSparsity, savedCorrelation := plantedRank, sparsity, correlation
+	savedNoise, savedLevel, savedSeed := noiseModel, noiseLevel, dataSeed
+	defer func() {
+		plantedRank, sparsity, correlation = savedRank, savedSparsity, savedCorrelation
+		noiseModel, noiseLevel, dataSeed = savedNoise, savedLevel, savedSeed
+	}()
+	m, n = 13, 11
+	plantedRank, sparsity, correlation, noiseLevel, dataSeed = 3, 0.3, 0.2, 0.1, 7
+
+	for _, model := range noiseModels {
+		noiseModel = model
+		A := synthPiece(0, m, 0, n)
+		if mat.Min(A) < 0 {
+			t.Errorf("%s: A has negative entries", model)
+		}
+		for _, b := range [][4]int{{0, 5, 0, 4}, {5, 8, 4, 7}, {12, 1, 10, 1}, {3, 4, 0, 11}} {
+			piece := synthPiece(b[0], b[1], b[2], b[3])
+			if !mat.Equal(piece, A.Slice(b[0], b[0]+b[1], b[2], b[2]+b[3])) {
+				t.Errorf("%s: block %v isn't that block of A", model, b)
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"time"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// TCP transport
+// Every node is its own OS process listening on 127.0.0.1:port+id, the launcher
+// (the process started by the user) is node p & gets the final W & H blocks.
+// A node dials a peer the first time it sends to it & keeps that connection, so
+// messages between 2 nodes stay in order. Incoming connections each get a reader
+// goroutine that decodes messages into the inbox. Messages are encoded as in
+// wire.go, with payload checksums if -checksum is set.
+
+type tcpTransport struct {
+	id    int
+	addrs []string // of every node, by world id
+	ln    net.Listener
+	conns []net.Conn      // outgoing, by dest
+	out   []*bufio.Writer // outgoing, by dest
+	inbox chan MatMessage
+	stats WireStats
+}
+
+// tcpAddrs - loopback address of every node & the launcher (last)
+func tcpAddrs(port, p int) []string {
+	addrs := make([]string, p+1)
+	for i := range addrs {
+		addrs[i] = "127.0.0.1:" + strconv.Itoa(port+i)
+	}
+	return addrs
+}
+
+func newTCPTransport(id int, addrs []string) (*tcpTransport, error) {
+	ln, err := net.Listen("tcp", addrs[id])
+	if err != nil {
+		return nil, err
+	}
+	t := &tcpTransport{
+		id:    id,
+		addrs: addrs,
+		ln:    ln,
+		conns: make([]net.Conn, len(addrs)),
+		out:   make([]*bufio.Writer, len(addrs)),
+		inbox: make(chan MatMessage, len(addrs)*3),
+	}
+	go t.accept()
+	return t, nil
+}
+
+func (t *tcpTransport) accept() {
+	for {
+		conn, err := t.ln.Accept()
+		if err != nil {
+			return // closed
+		}
+		go t.read(conn)
+	}
+}
+
+// read - decode messages from one peer until it hangs up
+func (t *tcpTransport) read(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReaderSize(conn, 1<<16)
+	for {
+		msg, n, err := readMessage(r, &t.stats)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			fatal(fmt.Errorf("node %d: reading from %s: %w", t.id, conn.RemoteAddr(), err))
+		}
+		t.stats.BytesIn.Add(int64(n))
+		t.inbox <- msg
+	}
+}
+
+// dial - connect to node dest, it may not be listening yet
+func (t *tcpTransport) dial(dest int) *bufio.Writer {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", t.addrs[dest])
+		if err == nil {
+			t.conns[dest] = conn
+			t.out[dest] = bufio.NewWriterSize(conn, 1<<16)
+			return t.out[dest]
+		}
+		if time.Now().After(deadline) {
+			fatal(fmt.Errorf("node %d: connecting to node %d: %w", t.id, dest, err))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func (t *tcpTransport) Send(dest int, msg MatMessage) {
+	w := t.out[dest]
+	if w == nil {
+		w = t.dial(dest)
+	}
+	n, err := writeMessage(w, msg, wireChecksum, &t.stats)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		fatal(fmt.Errorf("node %d: sending to node %d: %w", t.id, dest, err))
+	}
+	t.stats.BytesOut.Add(int64(n))
+}
+
+func (t *tcpTransport) Recv() MatMessage {
+	return <-t.inbox
+}
+
+// Close - hang up on everyone I've sent to & stop listening
+func (t *tcpTransport) Close() error {
+	var errs []error
+	for _, conn := range t.conns {
+		if conn != nil {
+			errs = append(errs, conn.Close())
+		}
+	}
+	errs = append(errs, t.ln.Close())
+	return errors.Join(errs...)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// Node reports
+// After its W & H blocks, every node sends the launcher one more message: its
+// stats, simulated clock & wire stats as a 1 x len vector.
+
+func reportOf(stats *CommStats, clock *SimClock, wire *WireStats) *mat.Dense {
+	r := []float64{float64(stats.Messages), float64(stats.Words), clock.Now, clock.Comm, clock.Compute, float64(clock.Iters)}
+	for _, phase := range phaseOrder {
+		r = append(r, clock.ByPhase[phase], clock.Flops[phase])
+	}
+	r = append(r, float64(wire.BytesOut.Load()), float64(wire.BytesIn.Load()),
+		float64(wire.Encode.Load()), float64(wire.Decode.Load()))
+	return mat.NewDense(1, len(r), r)
+}
+
+func parseReport(m mat.Dense) (*CommStats, *SimClock, [4]float64) {
+	r := m.RawRowView(0)
+	stats := &CommStats{Messages: int(r[0]), Words: int(r[1])}
+	clock := newSimClock()
+	clock.Now, clock.Comm, clock.Compute, clock.Iters = r[2], r[3], r[4], int(r[5])
+	r = r[6:]
+	for _, phase := range phaseOrder {
+		clock.ByPhase[phase] = r[0]
+		if r[1] > 0 {
+			clock.Flops[phase] = r[1]
+		}
+		r = r[2:]
+	}
+	return stats, clock, [4]float64{r[0], r[1], r[2], r[3]}
+}
+
+// runTCPNode - one node's process: parallelNMF (or parallelBetaNMF) over TCP, then report to the launcher
+func runTCPNode(cfg Config) error {
+	t, err := newTCPTransport(cfg.Rank, tcpAddrs(cfg.Port, numNodes))
+	if err != nil {
+		return err
+	}
+	aPiece, err := makeAPiece(cfg.Rank)
+	if err != nil {
+		return err
+	}
+	node := makeNode(newWorldComm(t, cfg.Rank, numNodes), make(chan MatMessage, 2), aPiece, cfg.Seed)
+	wg.Add(1)
+	nmfProgram()(node, cfg.MaxIter)
+
+	launcher := numNodes
+	t.Send(launcher, <-node.clientChan) // Wij
+	t.Send(launcher, <-node.clientChan) // Hji
+	t.Send(launcher, MatMessage{mtx: *reportOf(node.world.stats, node.world.clock, &t.stats), sentID: node.nodeID})
+	return t.Close()
+}
+
+// launch - start a process per node, pass their W & H blocks on to clientChan
+// Returns each node's stats & simulated clock once all are done.
+func launch(cfg Config, clientChan chan MatMessage) ([]*CommStats, []*SimClock, error) {
+	t, err := newTCPTransport(numNodes, tcpAddrs(cfg.Port, numNodes))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer t.Close()
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the nodes take -input's m, n & header from here instead of reading through it again
+	args := os.Args[1:]
+	if cfg.Data == dataFile {
+		args = append(slices.Clip(args), "-m", strconv.Itoa(cfg.M), "-n", strconv.Itoa(cfg.N), "-inputheader="+strconv.FormatBool(cfg.InputHeader))
+	}
+	procs := make([]*exec.Cmd, numNodes)
+	exited := make(chan error, numNodes)
+	for i := range procs {
+		procs[i] = exec.Command(exe, append(slices.Clip(args), "-rank", strconv.Itoa(i))...)
+		procs[i].Stdout, procs[i].Stderr = os.Stdout, os.Stderr
+		if err := procs[i].Start(); err != nil {
+			return nil, nil, fmt.Errorf("starting node %d: %w", i, err)
+		}
+		go func(i int) {
+			if err := procs[i].Wait(); err != nil {
+				exited <- fmt.Errorf("node %d: %w", i, err)
+				return
+			}
+			exited <- nil
+		}(i)
+	}
+
+	stats, clocks := make([]*CommStats, numNodes), make([]*SimClock, numNodes)
+	var wire [4]float64
+	collected := make(chan bool)
+	go func() {
+		for i := 0; i < 3*numNodes; i++ {
+			msg := t.Recv()
+			if msg.isFinalW || msg.isFinalH {
+				clientChan <- msg
+				continue
+			}
+			var w [4]float64
+			stats[msg.sentID], clocks[msg.sentID], w = parseReport(msg.mtx)
+			for j := range wire {
+				wire[j] += w[j]
+			}
+		}
+		close(collected)
+	}()
+
+	// a node that fails takes the run down with it
+	for i := 0; i < numNodes; i++ {
+		if err := <-exited; err != nil {
+			for _, proc := range procs {
+				proc.Process.Kill()
+			}
+			return nil, nil, err
+		}
+	}
+	<-collected
+
+	fmt.Printf("Wire: %.1f MB sent, %.1f MB received, encode %s, decode %s (all nodes)\n",
+		wire[0]/1e6, wire[1]/1e6, time.Duration(wire[2]), time.Duration(wire[3]))
+	return stats, clocks, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+// Transport - how a node's messages get to other nodes
+// Communicators only ever talk to their node's Transport, so the same parallelNMF
+// runs over:
+//	chan 	- Go channels, every node a goroutine in this process
+//	tcp 	- loopback sockets, every node its own OS process (see tcp.go)
+// Messages from one node to another must arrive in the order they were sent.
+type Transport interface {
+	// Send - deliver msg to world node dest
+	Send(dest int, msg MatMessage)
+	// Recv - next message sent to me, from anyone
+	Recv() MatMessage
+}
+
+const (
+	transportChan = "chan"
+	transportTCP  = "tcp"
+)
+
+var transports = []string{transportChan, transportTCP}
+
+// chanTransport - one inbox channel per node, shared by every node in the process
+type chanTransport struct {
+	inboxes []chan MatMessage
+	id      int
+}
+
+func (t chanTransport) Send(dest int, msg MatMessage) {
+	t.inboxes[dest] <- msg
+}
+
+func (t chanTransport) Recv() MatMessage {
+	return <-t.inboxes[t.id]
+}
+
+// makeChanTransports - transports for the nodes in this process, one inbox each
+func makeChanTransports(inboxes []chan MatMessage) []Transport {
+	ts := make([]Transport, len(inboxes))
+	for i := range ts {
+		ts[i] = chanTransport{inboxes: inboxes, id: i}
+	}
+	return ts
+}
@@ -0,0 +1,69 @@
+package main
+
+import "gonum.org/v1/gonum/mat"
+
+// Update rules for lines 8 & 14 of MPI-FAUN
+// All of them only need the Gram matrix & the product with A that the
+// distributed schedule already delivers, so the communication is the same.
+//
+//	mu 		- Lee-Seung multiplicative updates (main.go)
+//	hals 	- hierarchical ALS, one column of W (row of H) at a time (hals.go)
+//	bpp 	- ANLS, exact NNLS solves by block principal pivoting (bpp.go)
+const (
+	updateMU   = "mu"
+	updateHALS = "hals"
+	updateBPP  = "bpp"
+)
+
+var updateRules = []string{updateMU, updateHALS, updateBPP}
+
+// Update rule used by parallelNMF, set from the Config by applyConfig
+var updateRule = updateMU
+
+// updateW - line 8 with the update rule picked for the run
+func updateW(W *mat.Dense, HGramMat *mat.Dense, HProductMatij mat.Matrix) {
+	switch updateRule {
+	case updateHALS:
+		halsUpdateW(W, HGramMat, HProductMatij)
+	case updateBPP:
+		bppUpdateW(W, HGramMat, HProductMatij)
+	default:
+		muUpdateW(W, HGramMat, HProductMatij)
+	}
+}
+
+// FLOPs of updateW on a W with rows rows
+func updateWFlops(rows int) float64 {
+	switch updateRule {
+	case updateHALS:
+		return halsUpdateWFlops(rows)
+	case updateBPP:
+		return bppFlops(rows)
+	default:
+		return muUpdateWFlops(rows)
+	}
+}
+
+// updateH - line 14 with the update rule picked for the run
+func updateH(H *mat.Dense, WGramMat *mat.Dense, WProductMatji mat.Matrix) {
+	switch updateRule {
+	case updateHALS:
+		halsUpdateH(H, WGramMat, WProductMatji)
+	case updateBPP:
+		bppUpdateH(H, WGramMat, WProductMatji)
+	default:
+		muUpdateH(H, WGramMat, WProductMatji)
+	}
+}
+
+// FLOPs of updateH on an H with cols cols
+func updateHFlops(cols int) float64 {
+	switch updateRule {
+	case updateHALS:
+		return halsUpdateHFlops(cols)
+	case updateBPP:
+		return bppFlops(cols)
+	default:
+		return muUpdateHFlops(cols)
+	}
+}
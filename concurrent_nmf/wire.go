@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Wire format
+// How a MatMessage looks outside the process - on a TCP connection (tcp.go) or in
+// a checkpoint file (checkpoint.go). Header, little endian:
+//	magic "NMFM", version uint8, dtype uint8, flags uint8, reserved uint8,
+//	comm int64, sender tag iteration(epoch) int32, arrival float64,
+//	rows cols uint32, checksum uint32
+// then rows*cols values of dtype, row by row. The checksum is the CRC-32C of the
+// payload, only there (& only checked) when flagChecksum is set.
+// A reader refuses any other magic, version or dtype instead of guessing.
+
+const (
+	wireVersion   = 1
+	wireHeaderLen = 4 + 4 + 8 + 3*4 + 8 + 2*4 + 4
+
+	dtypeFloat64 = 1
+
+	maxPayload = 1 << 32 // values, more than any block of A, W or H
+)
+
+var wireMagic = [4]byte{'N', 'M', 'F', 'M'}
+
+// header flags
+const (
+	flagFinalW = 1 << iota
+	flagFinalH
+	flagChecksum
+)
+
+var (
+	errBadMagic    = errors.New("not a MatMessage (bad magic)")
+	errBadChecksum = errors.New("payload checksum mismatch")
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// wireChecksum - checksum the payloads of messages between nodes (-checksum)
+var wireChecksum bool
+
+// payloads can be read straight into a []float64 on little endian machines
+var nativeLittleEndian = binary.NativeEndian.Uint16([]byte{1, 0}) == 1
+
+// WireStats - bytes in & out, & the time spent (de)serializing
+type WireStats struct {
+	BytesOut atomic.Int64
+	BytesIn  atomic.Int64
+	Encode   atomic.Int64 // ns
+	Decode   atomic.Int64 // ns
+}
+
+// writeMessage - encode msg onto w, with a payload checksum if checksum is set
+// Returns the bytes written.
+func writeMessage(w io.Writer, msg MatMessage, checksum bool, stats *WireStats) (int, error) {
+	start := time.Now()
+	rows, cols := 0, 0
+	if !msg.mtx.IsEmpty() {
+		rows, cols = msg.mtx.Dims()
+	}
+	payload := payloadBytes(msg.mtx, rows, cols)
+
+	var header [wireHeaderLen]byte
+	copy(header[0:], wireMagic[:])
+	header[4] = wireVersion
+	header[5] = dtypeFloat64
+	var flags byte
+	if msg.isFinalW {
+		flags |= flagFinalW
+	}
+	if msg.isFinalH {
+		flags |= flagFinalH
+	}
+	if checksum {
+		flags |= flagChecksum
+		binary.LittleEndian.PutUint32(header[44:], crc32.Checksum(payload, castagnoli))
+	}
+	header[6] = flags
+	binary.LittleEndian.PutUint64(header[8:], uint64(msg.comm))
+	binary.LittleEndian.PutUint32(header[16:], uint32(msg.sentID))
+	binary.LittleEndian.PutUint32(header[20:], uint32(msg.tag))
+	binary.LittleEndian.PutUint32(header[24:], uint32(msg.epoch))
+	binary.LittleEndian.PutUint64(header[28:], math.Float64bits(msg.arrival))
+	binary.LittleEndian.PutUint32(header[36:], uint32(rows))
+	binary.LittleEndian.PutUint32(header[40:], uint32(cols))
+	stats.Encode.Add(int64(time.Since(start)))
+
+	n, err := w.Write(header[:])
+	if err != nil || len(payload) == 0 {
+		return n, err
+	}
+	m, err := w.Write(payload)
+	return n + m, err
+}
+
+// payloadBytes - mtx's values as little endian bytes, row by row
+// A contiguous matrix on a little endian machine is used as is (no copy).
+func payloadBytes(mtx mat.Dense, rows, cols int) []byte {
+	if rows*cols == 0 {
+		return nil
+	}
+	raw := mtx.RawMatrix()
+	if nativeLittleEndian && raw.Stride == cols {
+		return float64Bytes(raw.Data[:rows*cols])
+	}
+	buf := make([]byte, 0, 8*rows*cols)
+	for i := 0; i < rows; i++ {
+		for _, v := range raw.Data[i*raw.Stride : i*raw.Stride+cols] {
+			buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(v))
+		}
+	}
+	return buf
+}
+
+// readMessage - decode the next message from r, its payload in a pooled buffer
+// (see pool.go). Returns the bytes read; io.EOF only if r ended between messages.
+func readMessage(r io.Reader, stats *WireStats) (MatMessage, int, error) {
+	var header [wireHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return MatMessage{}, 0, err
+	}
+	start := time.Now()
+	switch {
+	case [4]byte(header[0:4]) != wireMagic:
+		return MatMessage{}, 0, errBadMagic
+	case header[4] != wireVersion:
+		return MatMessage{}, 0, fmt.Errorf("wire format version %d, this build reads version %d", header[4], wireVersion)
+	case header[5] != dtypeFloat64:
+		return MatMessage{}, 0, fmt.Errorf("unsupported dtype %d", header[5])
+	}
+	flags := header[6]
+	msg := MatMessage{
+		comm:     int(int64(binary.LittleEndian.Uint64(header[8:]))),
+		sentID:   int(int32(binary.LittleEndian.Uint32(header[16:]))),
+		tag:      int(int32(binary.LittleEndian.Uint32(header[20:]))),
+		epoch:    int(int32(binary.LittleEndian.Uint32(header[24:]))),
+		isFinalW: flags&flagFinalW != 0,
+		isFinalH: flags&flagFinalH != 0,
+		arrival:  math.Float64frombits(binary.LittleEndian.Uint64(header[28:])),
+	}
+	rows := int(binary.LittleEndian.Uint32(header[36:]))
+	cols := int(binary.LittleEndian.Uint32(header[40:]))
+	if uint64(rows)*uint64(cols) > maxPayload {
+		return msg, 0, fmt.Errorf("%d x %d payload is too big, corrupt header?", rows, cols)
+	}
+	if rows*cols == 0 {
+		stats.Decode.Add(int64(time.Since(start)))
+		return msg, wireHeaderLen, nil
+	}
+
+	// read the payload right into the matrix's backing slice
+	data := getBuffer(rows * cols)
+	payload := float64Bytes(data)
+	if !nativeLittleEndian {
+		payload = make([]byte, 8*len(data))
+	}
+	if _, err := io.ReadFull(r, payload); err != nil {
+		putBuffer(data)
+		return msg, 0, fmt.Errorf("message body: %w", io.ErrUnexpectedEOF)
+	}
+	start = time.Now()
+	if flags&flagChecksum != 0 && crc32.Checksum(payload, castagnoli) != binary.LittleEndian.Uint32(header[44:]) {
+		putBuffer(data)
+		return msg, 0, errBadChecksum
+	}
+	if !nativeLittleEndian {
+		for i := range data {
+			data[i] = math.Float64frombits(binary.LittleEndian.Uint64(payload[8*i:]))
+		}
+	}
+	msg.mtx = *mat.NewDense(rows, cols, data)
+	stats.Decode.Add(int64(time.Since(start)))
+	return msg, wireHeaderLen + len(payload), nil
+}
+
+// float64Bytes - the memory of data as bytes
+func float64Bytes(data []float64) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(data))), 8*len(data))
+}
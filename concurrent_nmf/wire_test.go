@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestWireRoundTrip(t *testing.T) {
+	big := mat.NewDense(4, 6, nil)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 6; j++ {
+			big.Set(i, j, float64(i*10+j)+0.25)
+		}
+	}
+	msgs := []MatMessage{
+		{},
+		{mtx: *mat.NewDense(1, 1, []float64{math.Pi}), comm: 42, sentID: 3, tag: tagAllReduce, epoch: 7, arrival: 1.5e-3},
+		{mtx: *mat.NewDense(2, 3, []float64{0, -1, math.Inf(1), math.MaxFloat64, math.SmallestNonzeroFloat64, -0.5}), tag: 5, isFinalW: true},
+		{mtx: *big.Slice(1, 3, 2, 5).(*mat.Dense), comm: -9, sentID: 1, epoch: 100, isFinalH: true}, // stride != cols
+	}
+	for _, checksum := range []bool{false, true} {
+		var buf bytes.Buffer
+		var stats WireStats
+		written := 0
+		for _, msg := range msgs {
+			n, err := writeMessage(&buf, msg, checksum, &stats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			written += n
+		}
+		if written != buf.Len() {
+			t.Errorf("checksum %v: writeMessage says %d bytes, wrote %d", checksum, written, buf.Len())
+		}
+
+		for i, want := range msgs {
+			got, _, err := readMessage(&buf, &stats)
+			if err != nil {
+				t.Fatalf("checksum %v, message %d: %v", checksum, i, err)
+			}
+			if got.comm != want.comm || got.sentID != want.sentID || got.tag != want.tag || got.epoch != want.epoch ||
+				got.isFinalW != want.isFinalW || got.isFinalH != want.isFinalH || got.arrival != want.arrival {
+				t.Errorf("checksum %v, message %d: header %+v, want %+v", checksum, i, got, want)
+			}
+			switch {
+			case want.mtx.IsEmpty():
+				if !got.mtx.IsEmpty() {
+					t.Errorf("checksum %v, message %d: empty matrix came back %v x %v", checksum, i, got.mtx.RawMatrix().Rows, got.mtx.RawMatrix().Cols)
+				}
+			case !mat.Equal(&got.mtx, &want.mtx):
+				t.Errorf("checksum %v, message %d: got\n%v\nwant\n%v", checksum, i, mat.Formatted(&got.mtx), mat.Formatted(&want.mtx))
+			}
+		}
+		if _, _, err := readMessage(&buf, &stats); err != io.EOF {
+			t.Errorf("checksum %v: after the last message got %v, want io.EOF", checksum, err)
+		}
+	}
+}
+
+func TestWireRejects(t *testing.T) {
+	var buf bytes.Buffer
+	msg := MatMessage{mtx: *mat.NewDense(2, 2, []float64{1, 2, 3, 4}), sentID: 1}
+	if _, err := writeMessage(&buf, msg, true, &WireStats{}); err != nil {
+		t.Fatal(err)
+	}
+	good := buf.Bytes()
+
+	corrupt := func(at int, b byte) []byte {
+		bad := bytes.Clone(good)
+		bad[at] = b
+		return bad
+	}
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"magic", corrupt(0, 'X'), errBadMagic.Error()},
+		{"version", corrupt(4, wireVersion+1), "version"},
+		{"dtype", corrupt(5, 9), "dtype"},
+		{"payload", corrupt(wireHeaderLen+3, 0xff), errBadChecksum.Error()},
+		{"truncated", good[:len(good)-1], io.ErrUnexpectedEOF.Error()},
+		{"short header", good[:wireHeaderLen-1], io.ErrUnexpectedEOF.Error()},
+	} {
+		_, _, err := readMessage(bytes.NewReader(tc.data), &WireStats{})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want an error about %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	k = 3
+	setGrid(7, 5, 2, 2)
+	dir := t.TempDir()
+	blocks := make([][2]*mat.Dense, numNodes)
+	for id := 0; id < numNodes; id++ {
+		W, H := mat.NewDense(wRows[id], k, nil), mat.NewDense(k, hCols[id], nil)
+		W.Apply(func(i, j int, _ float64) float64 { return float64(id) + float64(i)/7 + float64(j)/3 }, W)
+		H.Apply(func(i, j int, _ float64) float64 { return float64(id) - float64(i)/3 + float64(j)/5 }, H)
+		blocks[id] = [2]*mat.Dense{W, H}
+		if err := (&Node{nodeID: id}).saveCheckpoint(dir, W, H, 10+id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := 0; id < numNodes; id++ {
+		W, H, iters, err := (&Node{nodeID: id}).loadCheckpoint(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !mat.Equal(&W, blocks[id][0]) || !mat.Equal(&H, blocks[id][1]) || iters != 10+id {
+			t.Errorf("node %d: W, H or iterations (%d) didn't come back the same", id, iters)
+		}
+	}
+
+	// another m, n, grid or k gives other blocks
+	setGrid(12, 5, 2, 2)
+	if _, _, _, err := (&Node{nodeID: 1}).loadCheckpoint(dir); err == nil {
+		t.Error("loaded an m = 7 checkpoint with m = 12")
+	}
+	setGrid(7, 5, 1, 2)
+	if _, _, _, err := (&Node{nodeID: 1}).loadCheckpoint(dir); err == nil {
+		t.Error("loaded a 2 x 2 grid's checkpoint on a 1 x 2 grid")
+	}
+	setGrid(7, 5, 2, 2)
+	k = 4
+	if _, _, _, err := (&Node{nodeID: 0}).loadCheckpoint(dir); err == nil {
+		t.Error("loaded a k = 3 checkpoint with k = 4")
+	}
+	k = 3
+	if _, _, _, err := (&Node{nodeID: 0}).loadCheckpoint(t.TempDir()); err == nil {
+		t.Error("loaded a checkpoint from an empty directory")
+	}
+}
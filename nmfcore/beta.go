@@ -0,0 +1,174 @@
+package nmfcore
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Beta-divergence NMF, multiplicative updates on the whole matrices:
+//
+//	W = W * [((A * (W H)^(b-2)) Ht) / ((W H)^(b-1) Ht)]^g
+//	H = H * [(Wt (A * (W H)^(b-2))) / (Wt (W H)^(b-1))]^g
+//
+// b = 2 is the Frobenius norm, b = 1 KL, b = 0 Itakura-Saito. For KL (W H)^0 is a
+// ones matrix, so the denominators are only sums: every row of 1 Ht is the row sums
+// of H, every column of Wt 1 the column sums of W. g is the exponent, see BetaExponent.
+// concurrent_nmf's beta.go runs the same updates on a grid of nodes.
+
+// BetaEps - W H is floored at this (& A too, for b <= 0), so its powers & the
+// divergence stay finite
+const BetaEps = 1e-12
+
+// Exponent g of the updates
+//
+//	mm 			- majorization-minimization, the objective never goes up:
+//				  1/(2-b) for b < 1, 1 for 1 <= b <= 2, 1/(b-1) for b > 2
+//	heuristic 	- always 1, often faster but not guaranteed to go down for b outside [1, 2]
+const (
+	ExponentMM        = "mm"
+	ExponentHeuristic = "heuristic"
+)
+
+var Exponents = []string{ExponentMM, ExponentHeuristic}
+
+// BetaExponent - g for b, for the exponent picked
+func BetaExponent(beta float64, exponent string) float64 {
+	switch {
+	case exponent == ExponentHeuristic:
+		return 1
+	case beta < 1:
+		return 1 / (2 - beta)
+	case beta > 2:
+		return 1 / (beta - 1)
+	}
+	return 1
+}
+
+// BetaName - what the objective is called in the output
+func BetaName(beta float64) string {
+	switch beta {
+	case 1:
+		return "KL divergence"
+	case 0:
+		return "IS divergence"
+	}
+	return fmt.Sprintf("beta divergence (beta = %g)", beta)
+}
+
+// BetaDivergence - d_b(x | y) for one entry, y (& x, for b <= 0) floored at BetaEps
+func BetaDivergence(x, y, beta float64) float64 {
+	y = max(y, BetaEps)
+	if beta <= 0 {
+		x = max(x, BetaEps)
+	}
+	switch beta {
+	case 1:
+		if x == 0 {
+			return y
+		}
+		return x*math.Log(x/y) - x + y
+	case 0:
+		return x/y - math.Log(x/y) - 1
+	case 2:
+		return (x - y) * (x - y) / 2
+	}
+	return (math.Pow(x, beta) + (beta-1)*math.Pow(y, beta) - beta*x*math.Pow(y, beta-1)) / (beta * (beta - 1))
+}
+
+// BetaObjective - D_b(A || W H), the sum of d_b over the entries
+func BetaObjective(W, H, A *mat.Dense, beta float64) float64 {
+	WH := &mat.Dense{}
+	WH.Mul(W, H)
+	rows, _ := A.Dims()
+	d := 0.0
+	for i := 0; i < rows; i++ {
+		for j, y := range WH.RawRowView(i) {
+			d += BetaDivergence(A.At(i, j), y, beta)
+		}
+	}
+	return d
+}
+
+// betaRatios - R = A * (W H)^(b-2) & (unless b = 1) S = (W H)^(b-1), W H floored at BetaEps
+func betaRatios(W, H, A *mat.Dense, beta float64) (R, S *mat.Dense) {
+	WH := &mat.Dense{}
+	WH.Mul(W, H)
+	rows, cols := WH.Dims()
+	R = mat.NewDense(rows, cols, nil)
+	if beta != 1 {
+		S = mat.NewDense(rows, cols, nil)
+	}
+	for i := 0; i < rows; i++ {
+		r := R.RawRowView(i)
+		for j, y := range WH.RawRowView(i) {
+			y = max(y, BetaEps)
+			if beta == 1 {
+				r[j] = A.At(i, j) / y
+				continue
+			}
+			p := math.Pow(y, beta-2)
+			r[j] = A.At(i, j) * p
+			S.Set(i, j, p*y)
+		}
+	}
+	return R, S
+}
+
+// applyRatio - X = X * (numer / denom)^g
+func applyRatio(X, numer, denom *mat.Dense, gamma float64) {
+	numer.DivElem(numer, denom)
+	if gamma != 1 {
+		numer.Apply(func(_, _ int, v float64) float64 { return math.Pow(v, gamma) }, numer)
+	}
+	X.MulElem(X, numer)
+}
+
+// BetaUpdateW - W = W * [((A * (W H)^(b-2)) Ht) / ((W H)^(b-1) Ht)]^g
+func BetaUpdateW(W, H, A *mat.Dense, beta, gamma float64) {
+	R, S := betaRatios(W, H, A, beta)
+	numer, denom := &mat.Dense{}, &mat.Dense{}
+	numer.Mul(R, H.T()) // m x k
+	if beta == 1 {
+		// every row is the row sums of H
+		rows, k := numer.Dims()
+		denom.ReuseAs(rows, k)
+		for j := 0; j < k; j++ {
+			s := floats.Sum(H.RawRowView(j))
+			for i := 0; i < rows; i++ {
+				denom.Set(i, j, s)
+			}
+		}
+	} else {
+		denom.Mul(S, H.T()) // m x k
+	}
+	applyRatio(W, numer, denom, gamma)
+}
+
+// BetaUpdateH - H = H * [(Wt (A * (W H)^(b-2))) / (Wt (W H)^(b-1))]^g
+func BetaUpdateH(H, W, A *mat.Dense, beta, gamma float64) {
+	R, S := betaRatios(W, H, A, beta)
+	numer, denom := &mat.Dense{}, &mat.Dense{}
+	numer.Mul(W.T(), R) // k x n
+	if beta == 1 {
+		// every column is the column sums of W
+		rows, k := W.Dims()
+		s := make([]float64, k)
+		for i := 0; i < rows; i++ {
+			floats.Add(s, W.RawRowView(i))
+		}
+		_, cols := numer.Dims()
+		denom.ReuseAs(k, cols)
+		for j := 0; j < k; j++ {
+			row := denom.RawRowView(j)
+			for c := range row {
+				row[c] = s[j]
+			}
+		}
+	} else {
+		denom.Mul(W.T(), S) // k x n
+	}
+	applyRatio(H, numer, denom, gamma)
+}
@@ -0,0 +1,89 @@
+package nmfcore
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// randomDense - r x c uniform on (lo, lo+1)
+func randomDense(rng *rand.Rand, r, c int, lo float64) *mat.Dense {
+	x := mat.NewDense(r, c, nil)
+	x.Apply(func(int, int, float64) float64 { return lo + rng.Float64() }, x)
+	return x
+}
+
+// TestBetaUpdatesDescend - with the mm exponent the divergence never goes up
+func TestBetaUpdatesDescend(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	for _, beta := range []float64{-0.5, 0, 0.5, 1, 1.5, 2, 3} {
+		A := randomDense(rng, 12, 9, 0.1)
+		W, H := randomDense(rng, 12, 3, 0.1), randomDense(rng, 3, 9, 0.1)
+		gamma := BetaExponent(beta, ExponentMM)
+		prev := BetaObjective(W, H, A, beta)
+		for iter := 0; iter < 30; iter++ {
+			BetaUpdateW(W, H, A, beta, gamma)
+			BetaUpdateH(H, W, A, beta, gamma)
+			d := BetaObjective(W, H, A, beta)
+			if d > prev*(1+1e-12) || math.IsNaN(d) {
+				t.Errorf("%s: went from %g to %g in iteration %d", BetaName(beta), prev, d, iter+1)
+				break
+			}
+			prev = d
+		}
+	}
+}
+
+// TestKLSums - for b = 1 the sums give the same update as the ones matrices
+func TestKLSums(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	A := randomDense(rng, 7, 5, 0)
+	W, H := randomDense(rng, 7, 2, 0.1), randomDense(rng, 2, 5, 0.1)
+
+	WH, ratio := &mat.Dense{}, &mat.Dense{}
+	WH.Mul(W, H)
+	ratio.DivElem(A, WH)
+	ones := mat.NewDense(7, 5, nil)
+	ones.Apply(func(int, int, float64) float64 { return 1 }, ones)
+	numer, denom, want := &mat.Dense{}, &mat.Dense{}, &mat.Dense{}
+	numer.Mul(ratio, H.T())
+	denom.Mul(ones, H.T())
+	want.DivElem(numer, denom)
+	want.MulElem(want, W)
+
+	BetaUpdateW(W, H, A, 1, 1)
+	if !mat.EqualApprox(W, want, 1e-12) {
+		t.Errorf("KL update of W:\n%v\nwant\n%v", mat.Formatted(W), mat.Formatted(want))
+	}
+
+	WH.Mul(W, H)
+	ratio.DivElem(A, WH)
+	numer, denom, want = &mat.Dense{}, &mat.Dense{}, &mat.Dense{}
+	numer.Mul(W.T(), ratio)
+	denom.Mul(W.T(), ones)
+	want.DivElem(numer, denom)
+	want.MulElem(want, H)
+	BetaUpdateH(H, W, A, 1, 1)
+	if !mat.EqualApprox(H, want, 1e-12) {
+		t.Errorf("KL update of H:\n%v\nwant\n%v", mat.Formatted(H), mat.Formatted(want))
+	}
+}
+
+func TestBetaDivergence(t *testing.T) {
+	for _, beta := range []float64{-1, 0, 0.5, 1, 2, 3} {
+		if d := BetaDivergence(2.5, 2.5, beta); math.Abs(d) > 1e-12 {
+			t.Errorf("d_%g(2.5 | 2.5) = %g, want 0", beta, d)
+		}
+		if d := BetaDivergence(1, 3, beta); d <= 0 {
+			t.Errorf("d_%g(1 | 3) = %g, want > 0", beta, d)
+		}
+	}
+	if d := BetaDivergence(3, 1, 2); d != 2 {
+		t.Errorf("d_2(3 | 1) = %g, want 2", d)
+	}
+	if d, want := BetaDivergence(0, 2, 1), 2.0; d != want {
+		t.Errorf("d_1(0 | 2) = %g, want %g", d, want)
+	}
+}
@@ -0,0 +1,355 @@
+package nmfcore
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Initialization (-init)
+// W & H start out nonnegative. Every program makes the same global W (m x k) & H
+// (k x n) for the same seed - the sequential ones all of it (Initial), concurrent_nmf
+// every node only its own blocks, off the same pieces:
+//	random 		- uniform on [0, 2 sqrt(mean(A)/k)), so W H is mean(A) on average
+//	nndsvd 		- nonnegative double SVD (Boutsidis & Gallopoulos, 2008) of a randomized
+//				  rank-k SVD of A, see NNDSVD. Leaves zeros, which MU never moves off of
+//				  (& whole zero columns of W, past the rank of A, that MU divides 0 by 0 on)
+//	nndsvda 	- nndsvd, zeros filled in with mean(A)
+//	nndsvdar 	- nndsvd, zeros filled in with uniform values on [0, mean(A)/100)
+//	acol 		- random Acol (Langville et al., 2006): column j of W is the average of
+//				  AcolColumns random columns of A, H is uniform on [0, 2/k)
+//	file 		- W & H from the text files -initw & -inith (see ReadBlock)
+// Random numbers come from a stream per row of W, column of H .. (see RNG), so whoever
+// only makes a block only draws its own, & the blocks don't depend on the grid.
+const (
+	InitRandom   = "random"
+	InitNNDSVD   = "nndsvd"
+	InitNNDSVDA  = "nndsvda"
+	InitNNDSVDAR = "nndsvdar"
+	InitAcol     = "acol"
+	InitFile     = "file"
+)
+
+var InitMethods = []string{InitRandom, InitNNDSVD, InitNNDSVDA, InitNNDSVDAR, InitAcol, InitFile}
+
+const (
+	AcolColumns   = 20    // columns of A averaged into each column of W
+	svdOversample = 10    // extra columns in the randomized SVD's sketch of A
+	svdPowerIters = 4     // power iterations of the randomized SVD
+	svdRcond      = 1e-10 // eigenvalues of a Gram matrix below this x the largest count as 0
+	nndsvdZero    = 1e-6  // nndsvd entries below this are 0
+)
+
+// Random streams, see RNG
+const (
+	StreamW     = iota + 1 // index = row of W
+	StreamH                // index = column of H
+	StreamOmega            // index = row of the randomized SVD's test matrix (column of A)
+	StreamAcol             // index = column of W, picks its columns of A
+	StreamNext             // first stream free for others (the synthetic data's)
+)
+
+// RNG - random numbers for index of stream, off seed
+func RNG(seed int64, stream, index int) *rand.Rand {
+	return rand.New(rand.NewPCG(uint64(seed), uint64(stream)<<40|uint64(index)))
+}
+
+// UniformRows - rows x k, uniform on [0, scale), row r from stream's index first+r
+// (rows of W, or columns of H transposed)
+func UniformRows(seed int64, stream, first, rows, k int, scale float64) *mat.Dense {
+	X := mat.NewDense(rows, k, nil)
+	for r := 0; r < rows; r++ {
+		rng := RNG(seed, stream, first+r)
+		row := X.RawRowView(r)
+		for j := range row {
+			row[j] = scale * rng.Float64()
+		}
+	}
+	return X
+}
+
+// RandomScale - the random init's scale, so W H is mean(A) on average
+func RandomScale(mean float64, k int) float64 {
+	return 2 * math.Sqrt(mean/float64(k))
+}
+
+// SVDOps - how RandomizedSVD gets at A, which it never needs whole
+// A sequential program passes products with all of A; a node of concurrent_nmf
+// products of its block & all-reduces over the grid, for its row & column block.
+type SVDOps struct {
+	TimesA   func(X *mat.Dense) *mat.Dense // A X, from the rows of X for A's columns ColStart..
+	TimesAt  func(Y *mat.Dense) *mat.Dense // At Y, from the rows of Y for A's rows
+	GramRows func(Y *mat.Dense) *mat.Dense // Yt Y of all of Y, from what TimesA returned
+	GramCols func(X *mat.Dense) *mat.Dense // Xt X of all of X, from what TimesAt returned
+	ColStart int                           // first of A's columns TimesAt returns rows for
+	Cols     int                           // how many
+}
+
+// RandomizedSVD - rank r <= k SVD A ~ U diag(S) Vt (Halko, Martinsson & Tropp, 2011),
+// of an m x n A, as the rows of U & V that ops returns
+// Q = orth(A Omega), Omega an n x (k + svdOversample) Gaussian test matrix, sharpened
+// by power iterations Q = orth(A orth(At Q)), then the SVD of the small B = Qt A.
+// r drops below k when A's rank does.
+func RandomizedSVD(ops SVDOps, m, n, k int, seed int64) (U *mat.Dense, S []float64, V *mat.Dense, err error) {
+	l := min(k+svdOversample, m, n)
+	Omega := mat.NewDense(ops.Cols, l, nil)
+	for c := 0; c < ops.Cols; c++ {
+		rng := RNG(seed, StreamOmega, ops.ColStart+c)
+		for j := 0; j < l; j++ {
+			Omega.Set(c, j, rng.NormFloat64())
+		}
+	}
+
+	Q, err := Orthonormalize(ops.TimesA(Omega), ops.GramRows)
+	for it := 0; it < svdPowerIters && err == nil; it++ {
+		var Z *mat.Dense
+		if Z, err = Orthonormalize(ops.TimesAt(Q), ops.GramCols); err == nil {
+			Q, err = Orthonormalize(ops.TimesA(Z), ops.GramRows)
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	Bt := ops.TimesAt(Q) // Cols x l, rows of (Qt A)t
+
+	// B Bt = Ub diag(S^2) Ubt, so U = Q Ub & V = Bt Ub diag(1/S)
+	Ub, S2, err := EigenBasis(ops.GramCols(Bt), k)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	S = make([]float64, len(S2))
+	for j, s2 := range S2 {
+		S[j] = math.Sqrt(s2)
+	}
+	U, V = &mat.Dense{}, &mat.Dense{}
+	U.Mul(Q, Ub)
+	V.Mul(Bt, Ub)
+	for j, s := range S {
+		for c := 0; c < ops.Cols; c++ {
+			V.Set(c, j, V.At(c, j)/s)
+		}
+	}
+	return U, S, V, nil
+}
+
+// Orthonormalize - orthonormal basis of X's columns, X V diag(1/sqrt(lambda)) from
+// the Gram matrix, twice (like CholeskyQR2) since once loses orthogonality to the
+// Gram matrix's condition number
+func Orthonormalize(X *mat.Dense, gram func(X *mat.Dense) *mat.Dense) (*mat.Dense, error) {
+	for range 2 {
+		_, cols := X.Dims()
+		V, lambda, err := EigenBasis(gram(X), cols)
+		if err != nil {
+			return nil, err
+		}
+		for j, l := range lambda {
+			s := 1 / math.Sqrt(l)
+			for i := 0; i < cols; i++ {
+				V.Set(i, j, V.At(i, j)*s)
+			}
+		}
+		next := &mat.Dense{}
+		next.Mul(X, V)
+		X = next
+	}
+	return X, nil
+}
+
+// EigenBasis - eigenvectors of the symmetric G (as columns) & their eigenvalues, largest
+// first, at most most of them, leaving out eigenvalues below svdRcond x the largest
+func EigenBasis(G *mat.Dense, most int) (*mat.Dense, []float64, error) {
+	size, _ := G.Dims()
+	sym := mat.NewSymDense(size, nil)
+	for i := 0; i < size; i++ {
+		for j := i; j < size; j++ {
+			sym.SetSym(i, j, G.At(i, j))
+		}
+	}
+	var eig mat.EigenSym
+	if !eig.Factorize(sym, true) {
+		return nil, nil, fmt.Errorf("eigendecomposition of a %d x %d Gram matrix didn't converge", size, size)
+	}
+	values := eig.Values(nil) // ascending
+	var vectors mat.Dense
+	eig.VectorsTo(&vectors)
+
+	var keep []int
+	for j := size - 1; j >= 0 && len(keep) < most; j-- {
+		if values[j] > svdRcond*values[size-1] {
+			keep = append(keep, j)
+		}
+	}
+	if len(keep) == 0 {
+		return nil, nil, errors.New("A is all 0, nothing to take an SVD of")
+	}
+	basis := mat.NewDense(size, len(keep), nil)
+	kept := make([]float64, len(keep))
+	for a, j := range keep {
+		kept[a] = values[j]
+		for i := 0; i < size; i++ {
+			basis.Set(i, a, vectors.At(i, j))
+		}
+	}
+	return basis, kept, nil
+}
+
+func positivePart(x float64) float64 { return math.Max(x, 0) }
+func negativePart(x float64) float64 { return math.Max(-x, 0) }
+
+// AddPartNorms - add the squares of X's positive entries to row at of norms, the negative ones' to row at+1, by column
+func AddPartNorms(norms *mat.Dense, at int, X *mat.Dense) {
+	rows, _ := X.Dims()
+	pos, neg := norms.RawRowView(at), norms.RawRowView(at+1)
+	for i := 0; i < rows; i++ {
+		for j, x := range X.RawRowView(i) {
+			if x > 0 {
+				pos[j] += x * x
+			} else {
+				neg[j] += x * x
+			}
+		}
+	}
+}
+
+// NNDSVD - rows of W from the rows of U, columns of H from the rows of V, before the
+// zeros get filled in (see FillZeros). norms is 4 x r: |u+|^2, |u-|^2, |v+|^2, |v-|^2
+// of all of u_j & v_j, by component (see AddPartNorms).
+// Component j of the SVD A ~ U diag(S) Vt gives column j of W & row j of H: the
+// positive (or negative) parts of u_j & v_j, whichever pair has the bigger product
+// of norms, scaled to sqrt(s_j x that product). Component 0 is all one sign (A >= 0),
+// it gives sqrt(s_0) |u_0| & sqrt(s_0) |v_0|. Past the rank of A, W & H are 0.
+func NNDSVD(U mat.Matrix, S []float64, V mat.Matrix, norms *mat.Dense, k int) (W, H *mat.Dense) {
+	wRows, _ := U.Dims()
+	hCols, _ := V.Dims()
+	W, H = mat.NewDense(wRows, k, nil), mat.NewDense(k, hCols, nil)
+	for j := range S {
+		up, un := math.Sqrt(norms.At(0, j)), math.Sqrt(norms.At(1, j))
+		vp, vn := math.Sqrt(norms.At(2, j)), math.Sqrt(norms.At(3, j))
+		part := math.Abs
+		wScale, hScale := math.Sqrt(S[j]), math.Sqrt(S[j])
+		switch {
+		case j == 0:
+		case up*vp >= un*vn && up*vp > 0:
+			part = positivePart
+			wScale, hScale = math.Sqrt(S[j]*up*vp)/up, math.Sqrt(S[j]*up*vp)/vp
+		case un*vn > 0:
+			part = negativePart
+			wScale, hScale = math.Sqrt(S[j]*un*vn)/un, math.Sqrt(S[j]*un*vn)/vn
+		default:
+			continue
+		}
+		for i := 0; i < wRows; i++ {
+			W.Set(i, j, wScale*part(U.At(i, j)))
+		}
+		for c := 0; c < hCols; c++ {
+			H.Set(j, c, hScale*part(V.At(c, j)))
+		}
+	}
+	return W, H
+}
+
+// FillZeros - NNDSVD's zeros in W (rows from wFirst) & H (columns from hFirst): mean
+// for nndsvda, uniform on [0, mean/100) off the row's (column's) stream for nndsvdar,
+// left at 0 for nndsvd
+func FillZeros(method string, W, H *mat.Dense, wFirst, hFirst int, mean float64, seed int64) {
+	fill := func(x float64, rng *rand.Rand) float64 {
+		switch {
+		case x >= nndsvdZero:
+			return x
+		case method == InitNNDSVDA:
+			return mean
+		case method == InitNNDSVDAR:
+			return mean / 100 * rng.Float64()
+		}
+		return 0
+	}
+	wRows, k := W.Dims()
+	for i := 0; i < wRows; i++ {
+		rng := RNG(seed, StreamW, wFirst+i)
+		for j := 0; j < k; j++ {
+			W.Set(i, j, fill(W.At(i, j), rng))
+		}
+	}
+	_, hCols := H.Dims()
+	for c := 0; c < hCols; c++ {
+		rng := RNG(seed, StreamH, hFirst+c)
+		for j := 0; j < k; j++ {
+			H.Set(j, c, fill(H.At(j, c), rng))
+		}
+	}
+}
+
+// Initial - the initial W (m x k) & H (k x n) for all of A, by method
+// (wPath & hPath for file)
+func Initial(A *mat.Dense, k int, method string, seed int64, wPath, hPath string) (W, H *mat.Dense, err error) {
+	m, n := A.Dims()
+	if method == InitFile {
+		if W, err = ReadMatrix(wPath, m, k); err != nil {
+			return nil, nil, err
+		}
+		H, err = ReadMatrix(hPath, k, n)
+		return W, H, err
+	}
+
+	mean := mat.Sum(A) / (float64(m) * float64(n))
+	switch method {
+	case InitNNDSVD, InitNNDSVDA, InitNNDSVDAR:
+		gram := func(X *mat.Dense) *mat.Dense { return product(X.T(), X) }
+		ops := SVDOps{
+			TimesA:   func(X *mat.Dense) *mat.Dense { return product(A, X) },
+			TimesAt:  func(Y *mat.Dense) *mat.Dense { return product(A.T(), Y) },
+			GramRows: gram,
+			GramCols: gram,
+			Cols:     n,
+		}
+		U, S, V, err := RandomizedSVD(ops, m, n, k, seed)
+		if err != nil {
+			return nil, nil, err
+		}
+		norms := mat.NewDense(4, len(S), nil)
+		AddPartNorms(norms, 0, U)
+		AddPartNorms(norms, 2, V)
+		W, H = NNDSVD(U, S, V, norms, k)
+		FillZeros(method, W, H, 0, 0, mean, seed)
+		return W, H, nil
+	case InitAcol:
+		return acolW(A, k, seed), mat.DenseCopyOf(UniformRows(seed, StreamH, 0, n, k, 2/float64(k)).T()), nil
+	}
+	scale := RandomScale(mean, k)
+	return UniformRows(seed, StreamW, 0, m, k, scale), mat.DenseCopyOf(UniformRows(seed, StreamH, 0, n, k, scale).T()), nil
+}
+
+// product - a b, new
+func product(a, b mat.Matrix) *mat.Dense {
+	P := &mat.Dense{}
+	P.Mul(a, b)
+	return P
+}
+
+// AcolPicks - the columns of A random Acol averages into column j of W (n columns in all)
+func AcolPicks(seed int64, j, n int) []int {
+	picks := make([]int, min(AcolColumns, n))
+	rng := RNG(seed, StreamAcol, j)
+	for p := range picks {
+		picks[p] = rng.IntN(n)
+	}
+	return picks
+}
+
+// acolW - column j of W is the average of AcolColumns random columns of A
+func acolW(A *mat.Dense, k int, seed int64) *mat.Dense {
+	m, n := A.Dims()
+	W := mat.NewDense(m, k, nil)
+	for j := 0; j < k; j++ {
+		picks := AcolPicks(seed, j, n)
+		for _, c := range picks {
+			for i := 0; i < m; i++ {
+				W.Set(i, j, W.At(i, j)+A.At(i, c)/float64(len(picks)))
+			}
+		}
+	}
+	return W
+}
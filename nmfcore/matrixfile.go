@@ -0,0 +1,99 @@
+package nmfcore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Text files of W & H (-init file, -planted)
+// A row a line, split by commas and/or whitespace. Blank lines & lines starting with
+// # are skipped.
+
+// ReadMatrix - all of a rows x cols matrix of nonnegative numbers from the text file path
+func ReadMatrix(path string, rows, cols int) (*mat.Dense, error) {
+	return ReadBlock(path, rows, cols, 0, rows, 0, cols)
+}
+
+// ReadBlock - the block of a rows x cols matrix in the text file path at (rowStart,
+// colStart), blockRows x blockCols. Reads the lines up to the block's last (to the end,
+// if that's the matrix's last, to catch extra rows) & only parses the block's fields.
+func ReadBlock(path string, rows, cols, rowStart, blockRows, colStart, blockCols int) (*mat.Dense, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	X := mat.NewDense(blockRows, blockCols, nil)
+	last := rowStart + blockRows
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), math.MaxInt32)
+	r := 0
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fields := strings.FieldsFunc(text, func(c rune) bool { return c == ',' || unicode.IsSpace(c) })
+		if r == rows || len(fields) != cols {
+			return nil, fmt.Errorf("%s:%d: want a %d x %d matrix", path, line, rows, cols)
+		}
+		if r >= rowStart && r < last {
+			for c, field := range fields[colStart : colStart+blockCols] {
+				x, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+				}
+				if !(x >= 0) || math.IsInf(x, 0) {
+					return nil, fmt.Errorf("%s:%d: %g, initial factors have to be nonnegative", path, line, x)
+				}
+				X.Set(r-rowStart, c, x)
+			}
+		}
+		r++
+		if r == last && last < rows {
+			return X, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if r != rows {
+		return nil, fmt.Errorf("%s: want a %d x %d matrix, got %d rows", path, rows, cols, r)
+	}
+	return X, nil
+}
+
+// WriteMatrix - X as a text file ReadMatrix reads, after a # comment line header
+func WriteMatrix(path string, X *mat.Dense, header string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	rows, cols := X.Dims()
+	fmt.Fprintf(w, "# %d x %d, %s\n", rows, cols, header)
+	line := make([]byte, 0, 64*cols)
+	for i := 0; i < rows; i++ {
+		line = line[:0]
+		for j, x := range X.RawRowView(i) {
+			if j > 0 {
+				line = append(line, ' ')
+			}
+			line = strconv.AppendFloat(line, x, 'g', -1, 64)
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err = errors.Join(w.Flush(), f.Close()); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
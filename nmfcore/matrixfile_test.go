@@ -0,0 +1,54 @@
+package nmfcore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestReadBlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "X.txt")
+	X := mat.NewDense(5, 4, nil)
+	X.Apply(func(i, j int, _ float64) float64 { return float64(i*10+j) + 0.5 }, X)
+	if err := WriteMatrix(path, X, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []struct{ r0, rows, c0, cols int }{
+		{0, 5, 0, 4}, {0, 2, 1, 2}, {3, 2, 0, 4}, {4, 1, 3, 1}, {1, 3, 2, 2},
+	} {
+		got, err := ReadBlock(path, 5, 4, b.r0, b.rows, b.c0, b.cols)
+		if err != nil {
+			t.Errorf("%+v: %v", b, err)
+			continue
+		}
+		if want := X.Slice(b.r0, b.r0+b.rows, b.c0, b.c0+b.cols); !mat.Equal(got, want) {
+			t.Errorf("%+v: got\n%v\nwant\n%v", b, mat.Formatted(got), mat.Formatted(want))
+		}
+	}
+}
+
+func TestReadBlockRejects(t *testing.T) {
+	dir := t.TempDir()
+	for _, tc := range []struct {
+		name, text string
+		r0, rows   int // block, of a 3 x 2 matrix (all the columns)
+		want       string
+	}{
+		{"extra row", "1 2\n3 4\n5 6\n7 8\n", 2, 1, "want a 3 x 2"},
+		{"short", "1 2\n3 4\n", 1, 2, "got 2 rows"},
+		{"ragged", "1 2\n3\n5 6\n", 0, 3, "want a 3 x 2"},
+		{"negative", "1 2\n3 -4\n5 6\n", 1, 1, "nonnegative"},
+		{"not a number", "1 2\n3 x\n5 6\n", 0, 3, "invalid syntax"},
+	} {
+		path := filepath.Join(dir, strings.ReplaceAll(tc.name, " ", "_"))
+		if err := os.WriteFile(path, []byte("# comment\n\n"+tc.text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadBlock(path, 3, 2, tc.r0, tc.rows, 0, 2); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want an error about %q", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+// Package nmfcore - the parts of NMF that concurrent_nmf & the sequential programs
+// share, so they all compute the same thing (import path 569-final-project/nmfcore,
+// like the rest of the course project)
+package nmfcore
+
+import "gonum.org/v1/gonum/mat"
+
+// Nonnegative least squares by block principal pivoting (BPP)
+// The ANLS updates solve min ||B X - C|| over X >= 0 from only G = Bt B (k x k) &
+// R = Bt C (k x r). Each column of X is its own problem. BPP (Kim & Park, 2011)
+// guesses which entries of a column are free (the passive set, the rest are 0),
+// solves G_PP x_P = R_P, & swaps every entry that breaks the KKT conditions in or
+// out, until none does. Columns with the same passive set share the Cholesky
+// factorization of G_PP (column grouping).
+const (
+	bppBackup = 3     // full swaps allowed without progress before swapping 1 at a time
+	bppZero   = 1e-12 // |x| below this counts as 0
+	bppRcond  = 1e-10 // smallest reciprocal condition number of G let through, see wellConditioned
+)
+
+// NNLS - X = argmin ||B X - C|| s.t. X >= 0, given only G = Bt B & R = Bt C
+// Starts from X's passive set (its positive entries), so X should hold the last iterate.
+func NNLS(gram *mat.Dense, R mat.Matrix, X *mat.Dense) {
+	rows, cols := X.Dims()
+	G := wellConditioned(gram)
+	C := mat.DenseCopyOf(R)
+	passive := make([]bool, rows*cols) // passive[i*cols+c] - x(i,c) is free
+	for i := 0; i < rows; i++ {
+		for c, x := range X.RawRowView(i) {
+			passive[i*cols+c] = x > 0
+		}
+	}
+	all := make([]int, cols)
+	for c := range all {
+		all[c] = c
+	}
+
+	Y := &mat.Dense{} // dual, G X - R
+	solvePassive(G, C, passive, X, all)
+	Y.Mul(G, X)
+	Y.Sub(Y, C)
+
+	backups := make([]int, cols)
+	best := make([]int, cols) // fewest infeasible entries seen
+	for c := range all {
+		backups[c], best[c] = bppBackup, rows+1
+	}
+	bad := make([]int, cols)
+	todo := infeasible(X, Y, passive, bad)
+	for round := 0; len(todo) > 0 && round < 5*rows; round++ {
+		for _, c := range todo {
+			switch {
+			case bad[c] < best[c]:
+				backups[c], best[c] = bppBackup, bad[c]
+				swapInfeasible(X, Y, passive, c, false)
+			case backups[c] > 0:
+				backups[c]--
+				swapInfeasible(X, Y, passive, c, false)
+			default:
+				// no progress for a while, only swap the last infeasible entry
+				swapInfeasible(X, Y, passive, c, true)
+			}
+		}
+		solvePassive(G, C, passive, X, todo)
+		Y.Mul(G, X)
+		Y.Sub(Y, C)
+		todo = infeasible(X, Y, passive, bad)
+	}
+
+	// out of rounds (doesn't happen in practice) - at least stay nonnegative
+	for i := 0; i < rows; i++ {
+		for c, x := range X.RawRowView(i) {
+			if x < 0 {
+				X.Set(i, c, 0)
+			}
+		}
+	}
+}
+
+// isInfeasible - x(i,c) breaks KKT: a free entry < 0, or a fixed one whose dual is < 0
+func isInfeasible(x, y float64, free bool) bool {
+	if free {
+		return x < -bppZero
+	}
+	return y < -bppZero
+}
+
+// infeasible - columns with entries breaking KKT, bad[c] = how many
+func infeasible(X, Y *mat.Dense, passive []bool, bad []int) []int {
+	rows, cols := X.Dims()
+	for c := range bad {
+		bad[c] = 0
+	}
+	for i := 0; i < rows; i++ {
+		x, y := X.RawRowView(i), Y.RawRowView(i)
+		for c := range bad {
+			if isInfeasible(x[c], y[c], passive[i*cols+c]) {
+				bad[c]++
+			}
+		}
+	}
+	var todo []int
+	for c, n := range bad {
+		if n > 0 {
+			todo = append(todo, c)
+		}
+	}
+	return todo
+}
+
+// swapInfeasible - move column c's infeasible entries (only the last, if last) in or out of the passive set
+func swapInfeasible(X, Y *mat.Dense, passive []bool, c int, last bool) {
+	rows, cols := X.Dims()
+	for i := rows - 1; i >= 0; i-- {
+		if isInfeasible(X.At(i, c), Y.At(i, c), passive[i*cols+c]) {
+			passive[i*cols+c] = !passive[i*cols+c]
+			if last {
+				return
+			}
+		}
+	}
+}
+
+// wellConditioned - G, plus a tiny ridge if it's (nearly) singular, as it is when
+// k is more than the rank of A. The ridge keeps the condition number of G, & so of
+// every G_PP, under about 1/bppRcond, so they all have Cholesky factorizations.
+func wellConditioned(gram *mat.Dense) *mat.SymDense {
+	n, _ := gram.Dims()
+	G := mat.NewSymDense(n, nil)
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			G.SetSym(i, j, gram.At(i, j))
+		}
+	}
+	var chol mat.Cholesky
+	if chol.Factorize(G) && chol.Cond() < 1/bppRcond {
+		return G
+	}
+	ridge := bppRcond * mat.Trace(G) // the largest eigenvalue is at most the trace
+	for i := 0; i < n; i++ {
+		G.SetSym(i, i, G.At(i, i)+ridge)
+	}
+	return G
+}
+
+// solvePassive - for each of cols, x_P = G_PP^-1 r_P & 0 elsewhere, one solve per passive set
+func solvePassive(G *mat.SymDense, C *mat.Dense, passive []bool, X *mat.Dense, cols []int) {
+	rows, all := X.Dims()
+	groups := make(map[string][]int)
+	key := make([]byte, rows)
+	for _, c := range cols {
+		for i := range key {
+			key[i] = 0
+			if passive[i*all+c] {
+				key[i] = 1
+			}
+		}
+		groups[string(key)] = append(groups[string(key)], c)
+	}
+
+	for set, group := range groups {
+		var free []int
+		for i := range set {
+			if set[i] == 1 {
+				free = append(free, i)
+			}
+		}
+		for _, c := range group {
+			for i := 0; i < rows; i++ {
+				X.Set(i, c, 0)
+			}
+		}
+		if len(free) == 0 {
+			continue
+		}
+
+		gpp := mat.NewSymDense(len(free), nil)
+		for a, i := range free {
+			for b := a; b < len(free); b++ {
+				gpp.SetSym(a, b, G.At(i, free[b]))
+			}
+		}
+		rhs := mat.NewDense(len(free), len(group), nil)
+		for a, i := range free {
+			for b, c := range group {
+				rhs.Set(a, b, C.At(i, c))
+			}
+		}
+		var chol mat.Cholesky
+		if !chol.Factorize(gpp) {
+			continue // G is all 0 (so is R), leave these columns at 0
+		}
+		var sol mat.Dense
+		chol.SolveTo(&sol, rhs)
+		for a, i := range free {
+			for b, c := range group {
+				X.Set(i, c, sol.At(a, b))
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package nmfcore
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// TestNNLS - the answer meets the KKT conditions: X >= 0, Y = G X - R >= 0 & X Y = 0,
+// from any start, & also when G is singular (more columns in B than its rank)
+func TestNNLS(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	for _, tc := range []struct{ rows, k, cols, rank int }{
+		{20, 3, 5, 3}, {50, 8, 30, 8}, {40, 10, 12, 4}, {5, 1, 7, 1},
+	} {
+		// B = rows x k of rank tc.rank, C has entries of both signs
+		L, Rt := mat.NewDense(tc.rows, tc.rank, nil), mat.NewDense(tc.rank, tc.k, nil)
+		L.Apply(func(int, int, float64) float64 { return rng.Float64() }, L)
+		Rt.Apply(func(int, int, float64) float64 { return rng.Float64() }, Rt)
+		B, C := &mat.Dense{}, mat.NewDense(tc.rows, tc.cols, nil)
+		B.Mul(L, Rt)
+		C.Apply(func(int, int, float64) float64 { return rng.NormFloat64() }, C)
+		G, R := &mat.Dense{}, &mat.Dense{}
+		G.Mul(B.T(), B)
+		R.Mul(B.T(), C)
+
+		for _, start := range []string{"zeros", "ones"} {
+			X := mat.NewDense(tc.k, tc.cols, nil)
+			if start == "ones" {
+				X.Apply(func(int, int, float64) float64 { return 1 }, X)
+			}
+			NNLS(G, R, X)
+
+			Y := &mat.Dense{}
+			Y.Mul(G, X)
+			Y.Sub(Y, R)
+			tol := 1e-8 * (mat.Norm(R, math.Inf(1)) + 1)
+			for i := 0; i < tc.k; i++ {
+				for c := 0; c < tc.cols; c++ {
+					x, y := X.At(i, c), Y.At(i, c)
+					if x < 0 || math.IsNaN(x) || y < -tol || math.Abs(x*y) > tol*(1+x) {
+						t.Errorf("%+v from %s: x(%d,%d) = %g, y = %g break KKT", tc, start, i, c, x, y)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package nmfcore
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Frobenius objective, the relative error ||A - W H||_F / ||A||_F
+// ||A - WH||_F^2 = ||A||^2 - 2 tr(W^T A H^T) + tr((W^T W)(H H^T))	(MPI-FAUN's trick)
+// Both traces are sums over the columns of H (or blocks of them):
+//
+//	<Wt A, H> 	& 	<(Wt W) H, H>
+//
+// from Wt W & Wt A, which an iteration has anyway, so A - W H is never formed.
+// concurrent_nmf adds up every node's terms (see convergence.go), the sequential
+// programs take them of the whole matrices.
+
+// RelativeErrorName - what the objective is called in the output
+const RelativeErrorName = "relative error"
+
+// GramTerms - <WtA, H> & <WGram H, H> for H & the products of W with its columns
+// (H a block of columns, if WtA is that block of Wt A)
+func GramTerms(WGram *mat.Dense, WtA mat.Matrix, H *mat.Dense) (cross, quad float64) {
+	tmp := &mat.Dense{}
+	tmp.MulElem(WtA, H)
+	cross = mat.Sum(tmp)
+	tmp.Mul(WGram, H)
+	tmp.MulElem(tmp, H)
+	return cross, mat.Sum(tmp)
+}
+
+// RelativeError - ||A - W H||_F / ||A||_F from ||A||_F^2 & the sums of GramTerms
+func RelativeError(normA2, cross, quad float64) float64 {
+	return math.Sqrt(math.Max(normA2-2*cross+quad, 0) / normA2)
+}
+
+// FrobeniusObjective - the relative error of W & H for all of A
+func FrobeniusObjective(W, H, A *mat.Dense) float64 {
+	WGram, WtA := &mat.Dense{}, &mat.Dense{}
+	WGram.Mul(W.T(), W)
+	WtA.Mul(W.T(), A)
+	cross, quad := GramTerms(WGram, WtA, H)
+	normA := mat.Norm(A, 2) // Frobenius
+	return RelativeError(normA*normA, cross, quad)
+}
@@ -0,0 +1,38 @@
+package nmfcore
+
+import (
+	"math"
+	"math/rand/v2"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// TestFrobeniusObjective - the Gram trick gives ||A - W H||_F / ||A||_F, & the terms
+// of column blocks of H add up to the whole
+func TestFrobeniusObjective(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 8))
+	A := randomDense(rng, 9, 8, 0)
+	W, H := randomDense(rng, 9, 3, 0), randomDense(rng, 3, 8, 0)
+
+	WH, diff := &mat.Dense{}, &mat.Dense{}
+	WH.Mul(W, H)
+	diff.Sub(A, WH)
+	want := mat.Norm(diff, 2) / mat.Norm(A, 2)
+	if got := FrobeniusObjective(W, H, A); math.Abs(got-want) > 1e-12 {
+		t.Errorf("FrobeniusObjective = %g, want %g", got, want)
+	}
+
+	WGram, WtA := &mat.Dense{}, &mat.Dense{}
+	WGram.Mul(W.T(), W)
+	WtA.Mul(W.T(), A)
+	cross, quad := 0.0, 0.0
+	for _, b := range [][2]int{{0, 3}, {3, 4}, {4, 8}} {
+		c, q := GramTerms(WGram, WtA.Slice(0, 3, b[0], b[1]), H.Slice(0, 3, b[0], b[1]).(*mat.Dense))
+		cross, quad = cross+c, quad+q
+	}
+	normA := mat.Norm(A, 2)
+	if got := RelativeError(normA*normA, cross, quad); math.Abs(got-want) > 1e-12 {
+		t.Errorf("from column blocks = %g, want %g", got, want)
+	}
+}
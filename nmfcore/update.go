@@ -0,0 +1,140 @@
+package nmfcore
+
+import (
+	"gonum.org/v1/gonum/floats"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Frobenius-norm updates on the whole matrices, what sequential_mu_nmf runs & what
+// concurrent_nmf's -crosscheck compares against. They work out their own Gram matrices
+// & products with A, & don't share any code with concurrent_nmf's update kernels (only
+// the NNLS solver of bpp, see nnls.go).
+//
+//	mu 		- Lee-Seung multiplicative updates
+//	hals 	- hierarchical ALS, one column of W (row of H) at a time
+//	bpp 	- ANLS, exact NNLS solves by block principal pivoting
+const (
+	UpdateMU   = "mu"
+	UpdateHALS = "hals"
+	UpdateBPP  = "bpp"
+)
+
+var Updates = []string{UpdateMU, UpdateHALS, UpdateBPP}
+
+// HALSEps - HALS clips W & H at this, so nothing gets stuck at 0
+const HALSEps = 1e-16
+
+// Iterate - one iteration of the update rule: W, then H from the new W
+func Iterate(W, H, A *mat.Dense, update string) {
+	switch update {
+	case UpdateHALS:
+		HALSUpdateW(W, H, A)
+		HALSUpdateH(H, W, A)
+	case UpdateBPP:
+		BPPUpdateW(W, H, A)
+		BPPUpdateH(H, W, A)
+	default:
+		MUUpdateW(W, H, A)
+		MUUpdateH(H, W, A)
+	}
+}
+
+// MUUpdateW - W = W * ((A @ Ht) / (W @ H @ Ht))
+func MUUpdateW(W, H, A *mat.Dense) {
+	update := &mat.Dense{}
+	update.Mul(A, H.T()) // m x k
+
+	denom1 := &mat.Dense{}
+	denom1.Mul(H, H.T()) // k x k
+	denom := &mat.Dense{}
+	denom.Mul(W, denom1) // m x k
+
+	update.DivElem(update, denom)
+	W.MulElem(W, update)
+}
+
+// MUUpdateH - H = H * ((Wt @ A) / (Wt @ W @ H))
+func MUUpdateH(H, W, A *mat.Dense) {
+	update := &mat.Dense{}
+	update.Mul(W.T(), A) // k x n
+
+	denom1 := &mat.Dense{}
+	denom1.Mul(W.T(), W) // k x k
+	denom := &mat.Dense{}
+	denom.Mul(denom1, H) // k x n
+
+	update.DivElem(update, denom)
+	H.MulElem(H, update)
+}
+
+// HALSUpdateW - W(:,j) = max(eps, W(:,j) + ((A @ Ht)(:,j) - W @ (H @ Ht)(:,j)) / (H @ Ht)(j,j)),
+// for j = 0 .. k-1
+func HALSUpdateW(W, H, A *mat.Dense) {
+	P := &mat.Dense{}
+	P.Mul(A, H.T()) // m x k
+	G := &mat.Dense{}
+	G.Mul(H, H.T()) // k x k
+
+	m, k := W.Dims()
+	for j := 0; j < k; j++ {
+		gjj := G.At(j, j)
+		if gjj == 0 {
+			continue
+		}
+		g := G.RawRowView(j) // = column j, G is symmetric
+		for i := 0; i < m; i++ {
+			w := W.RawRowView(i)
+			w[j] = max(HALSEps, w[j]+(P.At(i, j)-floats.Dot(w, g))/gjj)
+		}
+	}
+}
+
+// HALSUpdateH - H(j,:) = max(eps, H(j,:) + ((Wt @ A)(j,:) - (Wt @ W)(j,:) @ H) / (Wt @ W)(j,j)),
+// for j = 0 .. k-1
+func HALSUpdateH(H, W, A *mat.Dense) {
+	Q := &mat.Dense{}
+	Q.Mul(W.T(), A) // k x n
+	G := &mat.Dense{}
+	G.Mul(W.T(), W) // k x k
+
+	k, n := H.Dims()
+	gh := make([]float64, n)
+	for j := 0; j < k; j++ {
+		gjj := G.At(j, j)
+		if gjj == 0 {
+			continue
+		}
+		for c := range gh {
+			gh[c] = 0
+		}
+		for l, g := range G.RawRowView(j) {
+			floats.AddScaled(gh, g, H.RawRowView(l))
+		}
+		h := H.RawRowView(j)
+		for c := range h {
+			h[c] = max(HALSEps, h[c]+(Q.At(j, c)-gh[c])/gjj)
+		}
+	}
+}
+
+// BPPUpdateW - W = argmin ||H^T W^T - A^T||, W >= 0, from H @ Ht & A @ Ht
+func BPPUpdateW(W, H, A *mat.Dense) {
+	P := &mat.Dense{}
+	P.Mul(A, H.T()) // m x k
+	G := &mat.Dense{}
+	G.Mul(H, H.T()) // k x k
+
+	Wt := mat.DenseCopyOf(W.T())
+	NNLS(G, P.T(), Wt)
+	W.Copy(Wt.T())
+}
+
+// BPPUpdateH - H = argmin ||W H - A||, H >= 0, from Wt @ W & Wt @ A
+func BPPUpdateH(H, W, A *mat.Dense) {
+	Q := &mat.Dense{}
+	Q.Mul(W.T(), A) // k x n
+	G := &mat.Dense{}
+	G.Mul(W.T(), W) // k x k
+
+	NNLS(G, Q, H)
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"math"
-	"math/rand"
+	"os"
+	"slices"
 	"time"
 
+	"569-final-project/nmfcore"
+
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -25,51 +29,51 @@ func matPrint(X mat.Matrix) {
 	fmt.Printf("%v\n", fa)
 }
 
-// Multiplicative Update: H = H * ((Wt @ (V / (W @ H))) / (Wt @ 1) )
-func updateH(H *mat.Dense, W *mat.Dense, A *mat.Dense, ones *mat.Dense) {
-	numerRHS := &mat.Dense{}
-	numerRHS.Mul(W, H)
-	numerRHS.DivElem(A, numerRHS)
-
-	update := &mat.Dense{}
-	update.Mul(W.T(), numerRHS)
-
-	denom := &mat.Dense{}
-	denom.Mul(W.T(), ones)
-
-	update.DivElem(update, denom)
-	H.MulElem(H, update)
-}
-
-// Multiplicative Update: W = W * (((V / (W @ H)) @ Ht) / (1 @ Ht) )
-func updateW(W *mat.Dense, H *mat.Dense, A *mat.Dense, ones *mat.Dense) {
-	numerLHS := &mat.Dense{}
-	numerLHS.Mul(W, H)
-	numerLHS.DivElem(A, numerLHS)
-
-	update := &mat.Dense{}
-	update.Mul(numerLHS, H.T())
-
-	denom := &mat.Dense{}
-	denom.Mul(ones, H.T())
-
-	update.DivElem(update, denom)
-	W.MulElem(W, update)
-}
+// KL NMF - the beta-divergence multiplicative updates of nmfcore/beta.go with
+// beta = 1, where the ones matrices of the textbook update are row sums of H &
+// column sums of W. sequential_mu_nmf -betadiv 1 runs the same thing.
+const klBeta = 1
 
-func nmf(W *mat.Dense, H *mat.Dense, A *mat.Dense, ones *mat.Dense, maxIter int) (*mat.Dense, *mat.Dense) {
-	fmt.Println("Doing NMF")
+func nmf(W *mat.Dense, H *mat.Dense, A *mat.Dense, maxIter int) (*mat.Dense, *mat.Dense) {
+	fmt.Println("Doing NMF with", nmfcore.BetaName(klBeta))
 	for iter := 0; iter < maxIter; iter++ {
-		updateW(W, H, A, ones)
-		updateH(H, W, A, ones)
+		nmfcore.BetaUpdateW(W, H, A, klBeta, 1)
+		nmfcore.BetaUpdateH(H, W, A, klBeta, 1)
 	}
 
 	return W, H
 }
 
-const m, n, k = 2048, 1024, 400
+// Sizes of A (m x n) & the rank k, & the iterations, set from the flags
+var m, n, k = 2048, 1024, 400
+var maxIter = 100
+
+// Init settings, set from the flags
+var (
+	initMethod           = nmfcore.InitRandom
+	initWPath, initHPath string
+	seed                 int64 = 1
+)
 
 func main() {
+	flag.IntVar(&m, "m", m, "rows of A")
+	flag.IntVar(&n, "n", n, "columns of A")
+	flag.IntVar(&k, "k", k, "rank of the factorization")
+	flag.IntVar(&maxIter, "iters", maxIter, "number of NMF iterations")
+	flag.StringVar(&initMethod, "init", initMethod, "initial W & H: random (uniform), nndsvd, nndsvda, nndsvdar, acol (random Acol) or file (see -initw, -inith)")
+	flag.StringVar(&initWPath, "initw", "", "-init file: text file of W (m x k), a row a line")
+	flag.StringVar(&initHPath, "inith", "", "-init file: text file of H (k x n), a row a line")
+	flag.Int64Var(&seed, "seed", seed, "seed for random initialization")
+	flag.Parse()
+	if m <= 0 || n <= 0 || k <= 0 || maxIter <= 0 {
+		fmt.Fprintln(os.Stderr, "m, n, k & iters must be positive")
+		os.Exit(2)
+	}
+	if !slices.Contains(nmfcore.InitMethods, initMethod) {
+		fmt.Fprintln(os.Stderr, "unknown init", initMethod)
+		os.Exit(2)
+	}
+
 	// Initialize input matrix A
 	a := make([]float64, m*n)
 	for i := 0; i < m*n; i++ {
@@ -79,28 +83,16 @@ func main() {
 	//println("A:")
 	//matPrint(A)
 
-	// Initialize factors W & H
-	w := make([]float64, m*k)
-	for i := range w {
-		w[i] = rand.NormFloat64()
-	}
-	W := mat.NewDense(m, k, w)
-
-	h := make([]float64, k*n)
-	for i := range h {
-		h[i] = rand.NormFloat64()
-	}
-	H := mat.NewDense(k, n, h)
-
-	o := make([]float64, m*n)
-	for i := 0; i < (m * n); i++ {
-		o[i] = 1
+	// Initialize factors W & H (see nmfcore/init.go)
+	W, H, err := nmfcore.Initial(A, k, initMethod, seed, initWPath, initHPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	ones := mat.NewDense(m, n, o)
 
 	startTime := time.Now()
 
-	nmf(W, H, A, ones, 100)
+	nmf(W, H, A, maxIter)
 
 	// fmt.Println("W:")
 	// matPrint(W)
@@ -113,6 +105,7 @@ func main() {
 	// approx = W.At(1, 0)*H.At(0, 1) + W.At(1, 1)*H.At(1, 1)
 	// fmt.Println("Approximate A[1][1] using W & H:", approx)
 
+	fmt.Printf("%s: %v\n", nmfcore.BetaName(klBeta), nmfcore.BetaObjective(W, H, A, klBeta))
 	approxA := &mat.Dense{}
 	approxA.Mul(W, H)
 	// Truncate values to no decimal
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"math"
-	"math/rand"
+	"os"
+	"slices"
 	"time"
 
+	"569-final-project/nmfcore"
+
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -25,45 +29,89 @@ func matPrint(X mat.Matrix) {
 	fmt.Printf("%v\n", fa)
 }
 
-// Multiplicative Update: H = H * ((Wt @ V) / (Wt @ 1 W @ H))
-func updateH(H *mat.Dense, W *mat.Dense, A *mat.Dense) {
-	update := &mat.Dense{}
-	update.Mul(W.T(), A) // k x n
-
-	denom1 := &mat.Dense{}
-	denom1.Mul(W.T(), W) // k x k
-	denom := &mat.Dense{}
-	denom.Mul(denom1, H) // k x n
-
-	update.DivElem(update, denom)
-	H.MulElem(H, update)
-}
-
-// Multiplicative Update: W = W * ((V @ Ht) / (W @ H @ 1 @ Ht))
-func updateW(W *mat.Dense, H *mat.Dense, A *mat.Dense) {
-	update := &mat.Dense{}
-	update.Mul(A, H.T()) // m x k
-
-	denom1 := &mat.Dense{}
-	denom1.Mul(H, H.T()) // k x k
-	denom := &mat.Dense{}
-	denom.Mul(W, denom1) // m x k
+// Set from the flags
+var (
+	betaDiv   = 2.0 // b of the beta divergence, 2 = Euclidean (use -update), see nmfcore/beta.go
+	betaGamma = 1.0 // exponent of the beta-divergence updates
+	track     bool  // print the objective every iteration
+)
 
-	update.DivElem(update, denom)
-	W.MulElem(W, update)
+func nmf(W *mat.Dense, H *mat.Dense, A *mat.Dense, maxIter int, update string) {
+	if betaDiv != 2 {
+		update = nmfcore.BetaName(betaDiv)
+	}
+	fmt.Println("Doing NMF with", update)
+	for iter := 0; iter < maxIter; iter++ {
+		// the whole-matrix updates of nmfcore/update.go & beta.go
+		if betaDiv != 2 {
+			nmfcore.BetaUpdateW(W, H, A, betaDiv, betaGamma)
+			nmfcore.BetaUpdateH(H, W, A, betaDiv, betaGamma)
+		} else {
+			nmfcore.Iterate(W, H, A, update)
+		}
+		if track {
+			name, value := objective(W, H, A)
+			fmt.Printf("Iteration %d: %s %.6g\n", iter+1, name, value)
+		}
+	}
 }
 
-func nmf(W *mat.Dense, H *mat.Dense, A *mat.Dense, maxIter int) {
-	fmt.Println("Doing NMF")
-	for iter := 0; iter < maxIter; iter++ {
-		updateW(W, H, A)
-		updateH(H, W, A)
+// objective - relative error ||A - W @ H||_F / ||A||_F for b = 2, else the beta divergence
+// The same objectives as concurrent_nmf's -trackerror (see nmfcore/objective.go & beta.go)
+func objective(W *mat.Dense, H *mat.Dense, A *mat.Dense) (string, float64) {
+	if betaDiv != 2 {
+		return nmfcore.BetaName(betaDiv), nmfcore.BetaObjective(W, H, A, betaDiv)
 	}
+	return nmfcore.RelativeErrorName, nmfcore.FrobeniusObjective(W, H, A)
 }
 
-const m, n, k = 2048, 1024, 400
+// Sizes of A (m x n) & the rank k, & the iterations, set from the flags
+var m, n, k = 2048, 1024, 400
+var maxIter = 100
+
+// Init settings, set from the flags
+var (
+	initMethod           = nmfcore.InitRandom
+	initWPath, initHPath string
+	seed                 int64 = 1
+)
 
 func main() {
+	update := flag.String("update", nmfcore.UpdateMU, "update rule: mu (multiplicative), hals or bpp (ANLS)")
+	flag.Float64Var(&betaDiv, "betadiv", betaDiv, "beta divergence to minimize: 2 Euclidean, 1 KL, 0 Itakura-Saito, or any other (multiplicative updates only)")
+	exponent := flag.String("exponent", "mm", "exponent of the beta-divergence updates: mm (majorization-minimization) or heuristic (1)")
+	flag.BoolVar(&track, "trackerror", false, "print the objective every iteration")
+	flag.IntVar(&m, "m", m, "rows of A")
+	flag.IntVar(&n, "n", n, "columns of A")
+	flag.IntVar(&k, "k", k, "rank of the factorization")
+	flag.IntVar(&maxIter, "iters", maxIter, "number of NMF iterations")
+	flag.StringVar(&initMethod, "init", initMethod, "initial W & H: random (uniform), nndsvd, nndsvda, nndsvdar, acol (random Acol) or file (see -initw, -inith)")
+	flag.StringVar(&initWPath, "initw", "", "-init file: text file of W (m x k), a row a line")
+	flag.StringVar(&initHPath, "inith", "", "-init file: text file of H (k x n), a row a line")
+	flag.Int64Var(&seed, "seed", seed, "seed for random initialization")
+	flag.Parse()
+	if m <= 0 || n <= 0 || k <= 0 || maxIter <= 0 {
+		fmt.Fprintln(os.Stderr, "m, n, k & iters must be positive")
+		os.Exit(2)
+	}
+	if !slices.Contains(nmfcore.Updates, *update) {
+		fmt.Fprintln(os.Stderr, "unknown update rule", *update)
+		os.Exit(2)
+	}
+	if !slices.Contains(nmfcore.Exponents, *exponent) {
+		fmt.Fprintln(os.Stderr, "unknown exponent", *exponent)
+		os.Exit(2)
+	}
+	if betaDiv != 2 && *update != nmfcore.UpdateMU {
+		fmt.Fprintln(os.Stderr, "beta divergences other than 2 only have multiplicative updates, not", *update)
+		os.Exit(2)
+	}
+	if !slices.Contains(nmfcore.InitMethods, initMethod) {
+		fmt.Fprintln(os.Stderr, "unknown init", initMethod)
+		os.Exit(2)
+	}
+	betaGamma = nmfcore.BetaExponent(betaDiv, *exponent)
+
 	// Initialize input matrix A
 	a := make([]float64, m*n)
 	for i := 0; i < m*n; i++ {
@@ -73,22 +121,16 @@ func main() {
 	//println("A:")
 	//matPrint(A)
 
-	// Initialize factors W & H
-	w := make([]float64, m*k)
-	for i := range w {
-		w[i] = rand.NormFloat64()
-	}
-	W := mat.NewDense(m, k, w)
-
-	h := make([]float64, k*n)
-	for i := range h {
-		h[i] = rand.NormFloat64()
+	// Initialize factors W & H (see nmfcore/init.go)
+	W, H, err := nmfcore.Initial(A, k, initMethod, seed, initWPath, initHPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-	H := mat.NewDense(k, n, h)
 
 	startTime := time.Now()
 
-	nmf(W, H, A, 100)
+	nmf(W, H, A, maxIter, *update)
 
 	// fmt.Println("W:")
 	// matPrint(W)
@@ -101,6 +143,8 @@ func main() {
 	// approx = W.At(1, 0)*H.At(0, 1) + W.At(1, 1)*H.At(1, 1)
 	// fmt.Println("Approximate A[1][1] using W & H:", approx)
 
+	name, value := objective(W, H, A)
+	fmt.Printf("%s: %v\n", name, value)
 	approxA := &mat.Dense{}
 	approxA.Mul(W, H)
 	// Truncate values to no decimal